@@ -0,0 +1,61 @@
+// accrual-fake - поддельная система расчета начислений для локальной разработки.
+//
+//	accrual-fake -a :8081 -script script.json
+//
+// Без -script все заказы проходят REGISTERED -> PROCESSING -> PROCESSED (500 баллов).
+// Сценарий заказа можно поменять на лету: PUT /fake/orders/{number} с JSON-массивом шагов
+package main
+
+import (
+	"errors"
+	"flag"
+	"gophermart/internal/accrualfake"
+	"gophermart/internal/logger"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	addr := flag.String("a", "localhost:8081", "адрес сервера")
+	scriptPath := flag.String("script", "", "JSON-файл со сценариями ответов")
+	latency := flag.Duration("latency", 0, "задержка каждого ответа")
+	flag.Parse()
+
+	if env := os.Getenv("RUN_ADDRESS"); env != "" {
+		*addr = env
+	}
+
+	if err := logger.Init(logger.WithLevel(logger.LoggerLevelINFO)); err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "logger Initialize"))
+	}
+
+	script := accrualfake.DefaultScript
+	if *scriptPath != "" {
+		f, err := os.Open(*scriptPath)
+		if err != nil {
+			logger.Log.Fatal(err.Error(), zap.String("init", "open script"))
+		}
+		script, err = accrualfake.LoadScript(f)
+		f.Close()
+		if err != nil {
+			logger.Log.Fatal(err.Error(), zap.String("init", "load script"))
+		}
+	}
+	if *latency > 0 {
+		script.Latency = accrualfake.Duration(*latency)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           accrualfake.New(script).Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	logger.Log.Info("Running fake accrual", zap.String("address", *addr), zap.String("script", *scriptPath))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Log.Fatal(err.Error(), zap.String("event", "start server"))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/model"
+	"gophermart/internal/pg"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage:
+  gophermart [flags]                    запуск сервера
+  gophermart [flags] migrate up         применить все новые миграции
+  gophermart [flags] migrate down [n]   откатить n последних миграций (по умолчанию 1)
+  gophermart [flags] migrate status     показать состояние миграций
+  gophermart [flags] password-reset <login>
+                                        отправить юзеру токен сброса пароля через нотификатор
+  gophermart [flags] set-role <login> <user|support|admin>
+                                        назначить юзеру роль, например первого админа`
+
+// userAdmin - операции над юзерами, доступные из командной строки
+type userAdmin interface {
+	RequestPasswordReset(ctx context.Context, login string) error
+	FindUser(ctx context.Context, login string) (model.User, error)
+	SetUserRole(ctx context.Context, userID int64, role string) error
+}
+
+// runCommand выполняет служебную команду вместо запуска сервера
+func runCommand(ctx context.Context, migrator *pg.Migrator, users userAdmin, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, migrator, args[1:])
+	case "password-reset":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := users.RequestPasswordReset(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("password reset token for %q sent\n", args[1])
+		return nil
+	case "set-role":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		user, err := users.FindUser(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if err := users.SetUserRole(ctx, user.ID, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("user %q (id %d) is now %s\n", user.Login, user.ID, args[2])
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(ctx context.Context, migrator *pg.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if migrator == nil {
+		return errors.New("migrate: database is not configured, set DATABASE_URI")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no new migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, mig := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.AppliedAt != nil {
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+}
@@ -2,28 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"gophermart/internal/accrual"
 	"gophermart/internal/config"
 	"gophermart/internal/crypto"
 	"gophermart/internal/handlers"
+	"gophermart/internal/health"
 	"gophermart/internal/logger"
+	"gophermart/internal/metrics"
+	"gophermart/internal/middleware"
+	"gophermart/internal/model"
+	"gophermart/internal/notify"
 	"gophermart/internal/pg"
 	"gophermart/internal/service"
+	"gophermart/internal/tracing"
 	"gophermart/internal/workers"
 	"gophermart/internal/workers/getaccrual"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 )
 
-const (
-	workerCount    = 3
-	workerSchedule = 0
-)
-
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	cfg := config.Init()
@@ -33,33 +37,185 @@ func main() {
 	}
 	logger.Log.Info("Step 1", zap.String("init", "config Initialized"))
 
+	shutdownTracing, err := tracing.Init(ctx, cfg.ServerConfig.Tracing)
+	if err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "tracing Initialize"))
+	}
+
 	db, err := pg.NewConnect(ctx, cfg.DBConfig.DBURI, cfg.DBConfig.DBTimeout)
 	if err != nil {
 		logger.Log.Fatal(err.Error(), zap.String("init", "db Initialize"))
 	}
 	logger.Log.Info("Step 2", zap.String("init", "db Initialized"), zap.String("cfg.DBURI", cfg.DBConfig.DBURI))
 
-	encrypter := crypto.NewEncrypter(cfg.ServerConfig.PassKey)
-	serv := service.New(db, encrypter)
+	// без DATABASE_URI репозиторий пустой: мигрировать нечего, migrator остается nil
+	var migrator *pg.Migrator
+	if db.DB != nil {
+		migrator, err = pg.NewMigrator(db.DB)
+		if err != nil {
+			logger.Log.Fatal(err.Error(), zap.String("init", "migrator Initialize"))
+		}
+	}
+
+	hasher, err := crypto.NewPasswordHasher(cfg.ServerConfig.PassHashAlgo)
+	if err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "password hasher Initialize"))
+	}
+	legacyEncrypter := crypto.NewEncrypter(cfg.ServerConfig.PassKey)
+	notifier, err := notify.New(cfg.ServerConfig.Notifier)
+	if err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "notifier Initialize"))
+	}
+	serviceOptions := []service.Option{
+		service.WithRefreshTokenTTL(cfg.ServerConfig.RefreshTokenTTL),
+		service.WithLoginThrottle(service.LoginThrottle{
+			FreeAttempts:   cfg.ServerConfig.LoginMaxAttempts,
+			IPFreeAttempts: cfg.ServerConfig.LoginIPMaxAttempts,
+			BaseLockout:    cfg.ServerConfig.LoginLockout,
+			MaxLockout:     cfg.ServerConfig.LoginMaxLockout,
+			Window:         service.DefaultLoginThrottle.Window,
+		}),
+		service.WithNotifier(notifier),
+		service.WithPasswordResetTTL(cfg.ServerConfig.PasswordResetTTL),
+	}
+	// без TOTP_SECRET_KEY 2FA недоступна, остальной сервис работает
+	if len(cfg.ServerConfig.TOTPSecretKey) > 0 {
+		serviceOptions = append(serviceOptions, service.WithSecretEncrypter(crypto.NewEncrypter(cfg.ServerConfig.TOTPSecretKey)))
+	}
+	serv := service.New(db, hasher, legacyEncrypter, serviceOptions...)
 	logger.Log.Info("Step 3", zap.String("init", "service Initialized"))
 
-	handler, err := handlers.New(serv, cfg.ServerConfig.SignatureKey)
+	// служебные команды выполняются вместо запуска сервера
+	if len(cfg.Args) > 0 {
+		if err := runCommand(ctx, migrator, serv, cfg.Args); err != nil {
+			logger.Log.Fatal(err.Error(), zap.Strings("command", cfg.Args))
+		}
+		return
+	}
+
+	if migrator != nil {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Log.Fatal(err.Error(), zap.String("init", "db migrate"))
+		}
+		for _, mig := range applied {
+			logger.Log.Info("Migration applied", zap.Int64("version", mig.Version), zap.String("name", mig.Name))
+		}
+	}
+
+	if db.DB != nil {
+		err = metrics.Register(
+			metrics.NewPoolCollector(db.DB),
+			metrics.NewQueueCollector(db, model.PendingOrderStatuses),
+		)
+		if err != nil {
+			logger.Log.Fatal(err.Error(), zap.String("init", "metrics Initialize"))
+		}
+	}
+
+	keyring, err := middleware.LoadKeyring(cfg.ServerConfig.SigningKeys, cfg.ServerConfig.SigningKeyID, cfg.ServerConfig.SignatureKey)
+	if err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "keyring Initialize"))
+	}
+
+	accrualClient := accrual.NewClient(cfg.ClientConfig.AccrualAddr, cfg.ClientConfig.ClientTimeout,
+		accrual.WithRateLimit(cfg.ClientConfig.RateLimit),
+		accrual.WithBreaker(accrual.BreakerConfig{
+			FailureThreshold: cfg.ClientConfig.BreakerFailures,
+			OpenTimeout:      cfg.ClientConfig.BreakerOpenTimeout,
+			HalfOpenProbes:   cfg.ClientConfig.BreakerProbes,
+		}),
+	)
+
+	hc := health.New(health.DefaultCheckTimeout)
+	hc.Add("db", db.Ping)
+	if migrator != nil {
+		hc.Add("migrations", func(ctx context.Context) error {
+			pending, err := migrator.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending migrations, first %04d_%s", len(pending), pending[0].Version, pending[0].Name)
+			}
+			return nil
+		})
+	}
+	hc.Add("accrual", accrualClient.Ping)
+
+	accrualWorker := getaccrual.New(serv, accrualClient,
+		getaccrual.WithPollInterval(cfg.ClientConfig.PollInterval),
+		getaccrual.WithBatch(cfg.ClientConfig.BatchSize, cfg.ClientConfig.LeaseTTL),
+		getaccrual.WithRetryPolicy(getaccrual.RetryPolicy{
+			MaxAttempts: cfg.ClientConfig.MaxAttempts,
+			BaseDelay:   cfg.ClientConfig.RetryBase,
+			MaxDelay:    cfg.ClientConfig.RetryMax,
+		}),
+	)
+	workerGroup := workers.NewGroup()
+	// воркеры спят, пока очередь пуста, и просыпаются по NOTIFY из AddOrder
+	wake := workers.NewSignal()
+	pool, err := workers.NewPool(workerGroup, accrualWorker, wake, workers.PoolConfig{
+		Min:              cfg.ClientConfig.WorkersMin,
+		Max:              cfg.ClientConfig.WorkersMax,
+		ScaleInterval:    cfg.ClientConfig.ScaleInterval,
+		BacklogPerWorker: cfg.ClientConfig.BacklogPerWorker,
+		MaxLatency:       cfg.ClientConfig.MaxLatency,
+	},
+		workers.WithBacklog(serv.CountAccrualBacklog),
+		workers.WithLatency(accrualClient.Latency),
+	)
+	if err != nil {
+		logger.Log.Fatal(err.Error(), zap.String("init", "worker pool Initialize"))
+	}
+
+	handler, err := handlers.New(serv, keyring,
+		handlers.WithTokenTTL(cfg.ServerConfig.AccessTokenTTL, cfg.ServerConfig.RefreshTokenTTL),
+		handlers.WithHealth(hc),
+		handlers.WithAccrualBreaker(accrualClient),
+		handlers.WithWorkerPool(pool),
+	)
 	if err != nil {
 		logger.Log.Fatal(err.Error(), zap.String("init", "set handler"))
 	}
 	logger.Log.Info("Step 4", zap.String("init", "handler Initialized"))
 
-	accrualClient := accrual.NewClient(cfg.ClientConfig.AccrualAddr, cfg.ClientConfig.ClientTimeout)
-	accrualWorker := getaccrual.New(serv, accrualClient)
-	for i := 0; i < workerCount; i++ {
-		workers.Start(ctx, accrualWorker, workerSchedule, i)
+	// без базы очереди заказов нет, воркерам нечего делать
+	if db.DB != nil {
+		workerGroup.Go(func() {
+			db.ListenNewOrders(ctx, wake.Broadcast)
+		})
+		workerGroup.Go(func() {
+			pool.Run(ctx)
+		})
 	}
 
 	logger.Log.Info("Step 5", zap.String("init", "workers started"))
 
+	server := &http.Server{
+		Addr:    cfg.ServerConfig.HTTPAddr,
+		Handler: handler.InitRouter(),
+	}
+
+	// метрики на отдельном адресе: пул, очередь и неудачные логины не должны быть видны снаружи
+	var metricsServer *http.Server
+	if cfg.ServerConfig.MetricsAddr != "-" {
+		metricsServer = &http.Server{
+			Addr:    cfg.ServerConfig.MetricsAddr,
+			Handler: metrics.Handler(),
+		}
+
+		logger.Log.Info("Running metrics server", zap.String("address", cfg.ServerConfig.MetricsAddr))
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Log.Fatal(err.Error(), zap.String("event", "start metrics server"))
+			}
+		}()
+	}
+
 	logger.Log.Info("Running server", zap.String("address", cfg.ServerConfig.HTTPAddr))
 	go func() {
-		if err := http.ListenAndServe(cfg.ServerConfig.HTTPAddr, handler.InitRouter()); err != nil {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Log.Fatal(err.Error(), zap.String("event", "start server"))
 		}
 	}()
@@ -68,9 +224,40 @@ func main() {
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 	<-done
 
+	// сначала readiness, чтобы балансировщик перестал слать запросы, пока сервер еще их обслуживает
+	hc.SetShuttingDown()
+	logger.Log.Info("Draining", zap.Duration("delay", cfg.ServerConfig.DrainDelay))
+	time.Sleep(cfg.ServerConfig.DrainDelay)
+
+	// на остановку сервера и воркеров один общий срок
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ServerConfig.ShutdownTimeout)
+	defer shutdownCancel()
+
 	logger.Log.Info("Stop server", zap.String("address", cfg.ServerConfig.HTTPAddr))
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Error("server shutdown error", zap.String("error", err.Error()))
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("metrics server shutdown error", zap.String("error", err.Error()))
+		}
+	}
 
+	logger.Log.Info("Stop workers")
 	cancel()
+	if err := workerGroup.Wait(shutdownCtx); err != nil {
+		logger.Log.Error("workers did not finish in time, aborting", zap.String("error", err.Error()))
+		workerGroup.Abort()
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Log.Error("tracing shutdown error", zap.String("error", err.Error()))
+	}
+
+	// пул последним: до этого момента им пользуются и сервер, и воркеры
+	if db.DB != nil {
+		db.DB.Close()
+	}
 
 	logger.Log.Info("Terminated. Goodbye")
 }
@@ -0,0 +1,213 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen - accrual недоступен, клиент не шлет запросы, пока не истечет пауза
+var ErrCircuitOpen = errors.New("accrual circuit breaker is open")
+
+// CircuitOpenError - запрос не отправлен, потому что breaker разомкнут. errors.Is(err, ErrCircuitOpen) == true
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrCircuitOpen, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerConfig - пороги circuit breaker
+type BreakerConfig struct {
+	// FailureThreshold - сколько отказов подряд размыкают цепь
+	FailureThreshold int
+	// OpenTimeout - сколько цепь разомкнута до пробных запросов
+	OpenTimeout time.Duration
+	// HalfOpenProbes - сколько пробных запросов подряд должны пройти, чтобы цепь замкнулась
+	HalfOpenProbes int
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenProbes:   1,
+}
+
+// halfOpenRetry - через сколько повторить, пока идут пробные запросы
+const halfOpenRetry = time.Second
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return model.BreakerStateClosed
+	case BreakerOpen:
+		return model.BreakerStateOpen
+	case BreakerHalfOpen:
+		return model.BreakerStateHalfOpen
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored - запрос ничего не сказал о здоровье accrual: отмена ctx, пауза после 429
+	outcomeIgnored
+)
+
+// breaker - общий для всех воркеров инстанса circuit breaker: closed -> open после FailureThreshold отказов подряд,
+// open -> half-open через OpenTimeout, half-open -> closed после HalfOpenProbes успешных проб или снова open при отказе
+type breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int // пробных запросов в полете
+	passed   int // успешных проб в half-open
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultBreakerConfig.FailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultBreakerConfig.OpenTimeout
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = DefaultBreakerConfig.HalfOpenProbes
+	}
+
+	return &breaker{cfg: cfg, now: time.Now}
+}
+
+// allow решает, можно ли слать запрос. Каждый разрешенный запрос обязан закончиться вызовом done
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		wait := b.openedAt.Add(b.cfg.OpenTimeout).Sub(b.now())
+		if wait > 0 {
+			return &CircuitOpenError{RetryAfter: wait}
+		}
+		b.setState(BreakerHalfOpen)
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes+b.passed >= b.cfg.HalfOpenProbes {
+			return &CircuitOpenError{RetryAfter: halfOpenRetry}
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+func (b *breaker) done(result outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == BreakerHalfOpen
+	if probe {
+		b.probes = max(b.probes-1, 0)
+	}
+
+	switch result {
+	case outcomeSuccess:
+		b.failures = 0
+		if probe {
+			b.passed++
+			if b.passed >= b.cfg.HalfOpenProbes {
+				b.setState(BreakerClosed)
+			}
+		}
+	case outcomeFailure:
+		b.failures++
+		if probe || (b.state == BreakerClosed && b.failures >= b.cfg.FailureThreshold) {
+			b.openedAt = b.now()
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+// setState логирует только смену состояния, повторные отказы в open в лог не попадают
+func (b *breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+
+	logger.Log.Warn("accrual circuit breaker state changed",
+		zap.Stringer("from", b.state), zap.Stringer("to", state), zap.Int("failures", b.failures))
+	metrics.AccrualBreakerState.Set(float64(state))
+
+	b.state = state
+	b.probes = 0
+	b.passed = 0
+}
+
+func (b *breaker) status() model.CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := model.CircuitBreakerStatus{
+		State:            b.state.String(),
+		Failures:         b.failures,
+		FailureThreshold: b.cfg.FailureThreshold,
+		OpenTimeout:      b.cfg.OpenTimeout.String(),
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+
+	return status
+}
+
+// outcomeOf - отказом считаются только сеть и 5xx. Ответ, который не разобрать, значит, что accrual жив
+func outcomeOf(ctx context.Context, err error) outcome {
+	if err == nil {
+		return outcomeSuccess
+	}
+
+	if ctx.Err() != nil {
+		return outcomeIgnored
+	}
+
+	if errors.Is(err, ErrUnavailable) {
+		return outcomeFailure
+	}
+
+	var unexpected *UnexpectedStatusError
+	if errors.As(err, &unexpected) && unexpected.Code >= http.StatusInternalServerError {
+		return outcomeFailure
+	}
+
+	return outcomeSuccess
+}
@@ -0,0 +1,80 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"gophermart/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenProbes: 2})
+	b.now = func() time.Time { return now }
+
+	// отказы не подряд цепь не размыкают
+	for _, result := range []outcome{outcomeFailure, outcomeFailure, outcomeSuccess, outcomeFailure, outcomeIgnored} {
+		require.NoError(t, b.allow())
+		b.done(result)
+	}
+	assert.Equal(t, BreakerClosed, b.state)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		b.done(outcomeFailure)
+	}
+	assert.Equal(t, BreakerOpen, b.state)
+
+	var open *CircuitOpenError
+	require.True(t, errors.As(b.allow(), &open))
+	assert.Equal(t, time.Minute, open.RetryAfter)
+
+	// после паузы - пробные запросы, не больше HalfOpenProbes разом
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	require.NoError(t, b.allow())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+	assert.Equal(t, BreakerHalfOpen, b.state)
+
+	// отказ пробы снова размыкает цепь
+	b.done(outcomeSuccess)
+	b.done(outcomeFailure)
+	assert.Equal(t, BreakerOpen, b.state)
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.allow())
+		b.done(outcomeSuccess)
+	}
+	assert.Equal(t, BreakerClosed, b.state)
+	assert.Equal(t, model.CircuitBreakerStatus{State: model.BreakerStateClosed, FailureThreshold: 3, OpenTimeout: "1m0s"}, b.status())
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, time.Second, WithBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}))
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetAccrual(context.Background(), "12345678903")
+		var unexpected *UnexpectedStatusError
+		require.True(t, errors.As(err, &unexpected))
+	}
+
+	_, err := c.GetAccrual(context.Background(), "12345678903")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), calls.Load(), "open breaker does not call accrual")
+	assert.Equal(t, model.BreakerStateOpen, c.BreakerStatus().State)
+}
@@ -3,5 +3,5 @@ package accrual
 import "net/http"
 
 type HTTPClient interface {
-	Get(url string) (resp *http.Response, err error)
+	Do(req *http.Request) (*http.Response, error)
 }
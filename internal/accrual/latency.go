@@ -0,0 +1,33 @@
+package accrual
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyWeight - вес нового замера: последние ~10 запросов определяют оценку
+const latencyWeight = 0.2
+
+// latency - скользящее среднее времени ответа accrual для автомасштабирования воркеров
+type latency struct {
+	mu   sync.Mutex
+	ewma time.Duration
+}
+
+func (l *latency) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ewma == 0 {
+		l.ewma = d
+		return
+	}
+	l.ewma = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(l.ewma))
+}
+
+func (l *latency) value() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.ewma
+}
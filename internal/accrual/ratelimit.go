@@ -0,0 +1,94 @@
+package accrual
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// defaultRetryAfter - пауза, если accrual ответил 429 без Retry-After
+const defaultRetryAfter = 10 * time.Second
+
+// advertisedLimitRe - так accrual сообщает свой лимит в теле ответа 429
+var advertisedLimitRe = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// parseRetryAfter понимает оба формата Retry-After: секунды и HTTP-дату
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return defaultRetryAfter
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return defaultRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0)
+	}
+
+	return defaultRetryAfter
+}
+
+// parseAdvertisedLimit достает лимит запросов в минуту из тела 429, 0 - не нашли
+func parseAdvertisedLimit(body []byte) int {
+	m := advertisedLimitRe.FindSubmatch(body)
+	if m == nil {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(string(m[1]))
+	if err != nil {
+		return 0
+	}
+
+	return limit
+}
+
+// throttle - общий для всех воркеров инстанса лимит запросов в accrual: token bucket и пауза после 429
+type throttle struct {
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// newThrottle: perMinute = 0 - без ограничения, пока accrual сам не сообщит лимит
+func newThrottle(perMinute int) *throttle {
+	t := &throttle{limiter: rate.NewLimiter(rate.Inf, 1)}
+	t.setLimit(perMinute)
+	return t
+}
+
+func (t *throttle) setLimit(perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+	t.limiter.SetLimit(rate.Limit(float64(perMinute) / 60))
+}
+
+// pause не дает никому из воркеров ходить в accrual до now+d. Паузы не укорачиваются
+func (t *throttle) pause(now time.Time, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := now.Add(d); until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+// paused возвращает, сколько еще ждать после последнего 429
+func (t *throttle) paused(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return max(t.pausedUntil.Sub(now), 0)
+}
@@ -0,0 +1,68 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "60", want: time.Minute},
+		{header: " 5 ", want: 5 * time.Second},
+		{header: "Wed, 01 May 2024 12:00:30 GMT", want: 30 * time.Second},
+		{header: "Wed, 01 May 2024 11:00:00 GMT", want: 0},
+		{header: "", want: defaultRetryAfter},
+		{header: "-1", want: defaultRetryAfter},
+		{header: "soon", want: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRetryAfter(tt.header, now))
+		})
+	}
+}
+
+func TestParseAdvertisedLimit(t *testing.T) {
+	assert.Equal(t, 42, parseAdvertisedLimit([]byte("No more than 42 requests per minute allowed")))
+	assert.Equal(t, 0, parseAdvertisedLimit([]byte("Too Many Requests")))
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("No more than 30 requests per minute allowed"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, time.Second)
+
+	result, err := c.GetAccrual(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, ResultRateLimited, result.Status)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+	assert.Equal(t, rate.Limit(0.5), c.throttle.limiter.Limit(), "limiter follows the advertised limit")
+
+	// пауза общая: следующий вызов даже не доходит до accrual
+	result, err = c.GetAccrual(context.Background(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, ResultRateLimited, result.Status)
+	assert.InDelta(t, time.Minute.Seconds(), result.RetryAfter.Seconds(), 1)
+	assert.Equal(t, int32(1), calls.Load())
+}
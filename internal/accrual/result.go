@@ -0,0 +1,81 @@
+package accrual
+
+import (
+	"errors"
+	"fmt"
+	"gophermart/internal/model"
+	"time"
+)
+
+var (
+	// ErrMalformedResponse - accrual ответил, но тело не разобрать. В отличие от сетевых ошибок это проблема конкретного заказа
+	ErrMalformedResponse = errors.New("malformed accrual response")
+	// ErrUnknownStatus - accrual вернул статус заказа, которого нет в его API
+	ErrUnknownStatus = errors.New("unknown accrual order status")
+	// ErrUnavailable - до accrual не достучались: сеть, таймаут клиента, отмена контекста
+	ErrUnavailable = errors.New("accrual unavailable")
+)
+
+// UnexpectedStatusError - accrual ответил HTTP-кодом, которого нет в его API, например 500
+type UnexpectedStatusError struct {
+	Code int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected accrual response code: %d", e.Code)
+}
+
+// ResultStatus - что accrual знает о заказе
+type ResultStatus int
+
+const (
+	ResultRegistered ResultStatus = iota + 1
+	ResultProcessing
+	ResultInvalid
+	ResultProcessed
+	// ResultNotFound - заказ еще не зарегистрирован в accrual (204)
+	ResultNotFound
+	// ResultRateLimited - accrual ответил 429 или клиент еще выдерживает паузу после него, ждать Result.RetryAfter
+	ResultRateLimited
+)
+
+var resultStatusNames = map[ResultStatus]string{
+	ResultRegistered:  "registered",
+	ResultProcessing:  "processing",
+	ResultInvalid:     "invalid",
+	ResultProcessed:   "processed",
+	ResultNotFound:    "not_found",
+	ResultRateLimited: "rate_limited",
+}
+
+func (s ResultStatus) String() string {
+	if name, ok := resultStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ResultStatus(%d)", int(s))
+}
+
+// Result - разобранный ответ accrual по заказу
+type Result struct {
+	Status ResultStatus
+	// Accrual заполнен для REGISTERED, PROCESSING, INVALID и PROCESSED
+	Accrual model.Accrual
+	// RetryAfter заполнен для ResultRateLimited
+	RetryAfter time.Duration
+}
+
+// resultStatusFor переводит статус из тела ответа в ResultStatus
+func resultStatusFor(status string) (ResultStatus, error) {
+	switch status {
+	case model.OrderStatusRegistered:
+		return ResultRegistered, nil
+	case model.OrderStatusProcessing:
+		return ResultProcessing, nil
+	case model.OrderStatusInvalid:
+		return ResultInvalid, nil
+	case model.OrderStatusProcessed:
+		return ResultProcessed, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+}
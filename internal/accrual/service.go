@@ -1,50 +1,236 @@
 package accrual
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"gophermart/internal/metrics"
 	"gophermart/internal/model"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const getAccrualPath = "/api/orders/%s"
 
+var tracer = otel.Tracer("gophermart/internal/accrual")
+
 type client struct {
 	BaseURL    string
 	HTTPClient HTTPClient
+	throttle   *throttle
+	breaker    *breaker
+	latency    latency
+
+	transport  *http.Transport
+	roundTrips []func(http.RoundTripper) http.RoundTripper
+}
+
+// Option описывает функциональную опцию для конфигурации клиента.
+type Option func(*client)
+
+// WithRateLimit ограничивает клиента perMinute запросами в минуту. Если accrual сообщит в ответе 429 свой лимит, клиент перейдет на него
+func WithRateLimit(perMinute int) Option {
+	return func(c *client) {
+		c.throttle.setLimit(perMinute)
+	}
+}
+
+// WithBreaker задает пороги circuit breaker
+func WithBreaker(cfg BreakerConfig) Option {
+	return func(c *client) {
+		c.breaker = newBreaker(cfg)
+	}
+}
+
+// WithTransport оборачивает транспорт клиента: повторы, заголовки авторизации, логирование.
+// Обертки применяются по порядку, последняя оказывается снаружи. Лимит и пауза после 429 работают до транспорта
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(c *client) {
+		c.roundTrips = append(c.roundTrips, wrap)
+	}
+}
+
+// WithTLSConfig задает TLS базового транспорта, например клиентский сертификат для mTLS
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *client) {
+		c.transport.TLSClientConfig = cfg
+	}
+}
+
+// RoundTripperFunc позволяет написать обертку транспорта функцией, как http.HandlerFunc
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func NewClient(baseURL string, clientTimeout time.Duration, options ...Option) *client {
+	c := &client{
+		BaseURL:   baseURL,
+		throttle:  newThrottle(0),
+		breaker:   newBreaker(DefaultBreakerConfig),
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	var transport http.RoundTripper = c.transport
+	for _, wrap := range c.roundTrips {
+		transport = wrap(transport)
+	}
+
+	c.HTTPClient = &http.Client{
+		Timeout:   clientTimeout,
+		Transport: transport,
+	}
+
+	return c
 }
 
-func NewClient(baseURL string, clientTimeout time.Duration) *client {
-	return &client{
-		BaseURL: baseURL,
-		HTTPClient: &http.Client{
-			Timeout: clientTimeout,
-		},
+// BreakerStatus отдает состояние circuit breaker для админки
+func (c *client) BreakerStatus() model.CircuitBreakerStatus {
+	return c.breaker.status()
+}
+
+// Latency - скользящее среднее времени ответа accrual, 0 - запросов еще не было
+func (c *client) Latency() time.Duration {
+	return c.latency.value()
+}
+
+// Ping проверяет, что система расчета доступна. Любой HTTP-ответ, даже 404 или 429, значит, что до нее можно достучаться
+func (c *client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/", nil)
+	if err != nil {
+		return fmt.Errorf("Ping NewRequest-err: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Ping Get-err: %w", err)
 	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return nil
 }
 
-func (c *client) GetAccrual(orderID string) (int, model.Accrual, error) {
+// GetAccrual запрашивает расчет по заказу и разбирает ответ в Result. Контекст трейса уходит в заголовках traceparent/tracestate.
+// На 429 и во время паузы после него возвращает ResultRateLimited, пауза общая для всех, кто пользуется клиентом.
+// Ошибки: ErrUnavailable (сеть, таймаут, отмена ctx), ErrMalformedResponse, ErrUnknownStatus, *UnexpectedStatusError,
+// *CircuitOpenError - запрос не отправлялся, accrual недавно был недоступен
+func (c *client) GetAccrual(ctx context.Context, orderID string) (result Result, err error) {
 	path := fmt.Sprintf(getAccrualPath, orderID)
 	url := fmt.Sprintf("%s%s", c.BaseURL, path)
 
-	resp, err := c.HTTPClient.Get(url)
+	ctx, span := tracer.Start(ctx, "accrual.GetAccrual",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("order_id", orderID),
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.full", url),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.String("accrual.result", result.Status.String()))
+		}
+		span.End()
+	}()
+
+	if err = c.breaker.allow(); err != nil {
+		return Result{}, err
+	}
+	// запрос, который так и не ушел, ничего не говорит о здоровье accrual
+	sent := false
+	defer func() {
+		if !sent {
+			c.breaker.done(outcomeIgnored)
+			return
+		}
+		c.breaker.done(outcomeOf(ctx, err))
+	}()
+
+	if err = c.throttle.limiter.Wait(ctx); err != nil {
+		return Result{}, fmt.Errorf("GetAccrual limiter-Wait-err: %w: %w", ErrUnavailable, err)
+	}
+
+	// пока ждали токен, другой воркер мог получить 429
+	if wait := c.throttle.paused(time.Now()); wait > 0 {
+		return Result{Status: ResultRateLimited, RetryAfter: wait}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("GetAccrual NewRequest-err: %w", err)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	sent = true
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	elapsed := time.Since(start)
+	metrics.AccrualDuration.Observe(elapsed.Seconds())
+	c.latency.observe(elapsed)
 	if err != nil {
-		return 0, model.Accrual{}, fmt.Errorf("GetAccrual Get-err: %w", err)
+		metrics.AccrualRequests.WithLabelValues("error").Inc()
+		return Result{}, fmt.Errorf("GetAccrual Get-err: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
+	metrics.AccrualRequests.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, model.Accrual{}, fmt.Errorf("GetAccrual ReadBody-err: %w", err)
+		return Result{}, fmt.Errorf("GetAccrual ReadBody-err: %w: %w", ErrUnavailable, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return Result{Status: ResultNotFound}, nil
+	case http.StatusTooManyRequests:
+		return Result{Status: ResultRateLimited, RetryAfter: c.rateLimited(resp.Header.Get("Retry-After"), body)}, nil
+	default:
+		return Result{}, fmt.Errorf("GetAccrual-err: %w", &UnexpectedStatusError{Code: resp.StatusCode})
 	}
 
 	var accrual model.Accrual
 	err = json.Unmarshal(body, &accrual)
 	if err != nil {
-		return 0, model.Accrual{}, fmt.Errorf("GetAccrual UnmarshalBody-err: %w", err)
+		return Result{}, fmt.Errorf("GetAccrual UnmarshalBody-err: %w: %w", ErrMalformedResponse, err)
+	}
+
+	status, err := resultStatusFor(accrual.Status)
+	if err != nil {
+		return Result{}, fmt.Errorf("GetAccrual-err: %w", err)
+	}
+
+	return Result{Status: status, Accrual: accrual}, nil
+}
+
+// rateLimited ставит общую паузу по Retry-After и подстраивает token bucket под лимит, который сообщил accrual
+func (c *client) rateLimited(retryAfter string, body []byte) time.Duration {
+	now := time.Now()
+	wait := parseRetryAfter(retryAfter, now)
+	c.throttle.pause(now, wait)
+
+	if limit := parseAdvertisedLimit(body); limit > 0 {
+		c.throttle.setLimit(limit)
 	}
 
-	return resp.StatusCode, accrual, nil
+	return wait
 }
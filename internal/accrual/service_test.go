@@ -0,0 +1,138 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"gophermart/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAccrual(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		body    string
+		want    Result
+		wantErr error
+	}{
+		{
+			name: "processed",
+			code: http.StatusOK,
+			body: `{"order":"12345678903","status":"PROCESSED","accrual":500.5}`,
+			want: Result{Status: ResultProcessed, Accrual: model.Accrual{Order: "12345678903", Status: model.OrderStatusProcessed, Accrual: 50050}},
+		},
+		{
+			name: "processed with sub-cent accrual",
+			code: http.StatusOK,
+			body: `{"order":"12345678903","status":"PROCESSED","accrual":729.985}`,
+			want: Result{Status: ResultProcessed, Accrual: model.Accrual{Order: "12345678903", Status: model.OrderStatusProcessed, Accrual: 72999}},
+		},
+		{
+			name: "registered",
+			code: http.StatusOK,
+			body: `{"order":"12345678903","status":"REGISTERED"}`,
+			want: Result{Status: ResultRegistered, Accrual: model.Accrual{Order: "12345678903", Status: model.OrderStatusRegistered}},
+		},
+		{
+			name: "not registered in accrual",
+			code: http.StatusNoContent,
+			want: Result{Status: ResultNotFound},
+		},
+		{
+			name:    "malformed body",
+			code:    http.StatusOK,
+			body:    `{"order":`,
+			wantErr: ErrMalformedResponse,
+		},
+		{
+			name:    "unknown status",
+			code:    http.StatusOK,
+			body:    `{"order":"12345678903","status":"DONE"}`,
+			wantErr: ErrUnknownStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/orders/12345678903", r.URL.Path)
+				w.WriteHeader(tt.code)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			result, err := NewClient(ts.URL, time.Second).GetAccrual(context.Background(), "12345678903")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result)
+		})
+	}
+}
+
+func TestGetAccrualErrors(t *testing.T) {
+	t.Run("unexpected code", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		_, err := NewClient(ts.URL, time.Second).GetAccrual(context.Background(), "12345678903")
+
+		var unexpected *UnexpectedStatusError
+		require.True(t, errors.As(err, &unexpected))
+		assert.Equal(t, http.StatusInternalServerError, unexpected.Code)
+	})
+
+	t.Run("canceled request", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err := NewClient(ts.URL, time.Minute).GetAccrual(ctx, "12345678903")
+		assert.ErrorIs(t, err, ErrUnavailable)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestWithTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	var calls int
+	c := NewClient(ts.URL, time.Second,
+		WithTransport(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set("Authorization", "Bearer token")
+				return next.RoundTrip(req)
+			})
+		}),
+		WithTransport(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return next.RoundTrip(req)
+			})
+		}),
+	)
+
+	result, err := c.GetAccrual(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, ResultNotFound, result.Status)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,245 @@
+// Package accrualfake - поддельная система расчета начислений для локальной разработки и тестов.
+// Отвечает на GET /api/orders/{number} по сценарию: каждый запрос по заказу берет следующий шаг,
+// последний шаг повторяется. Сценарий задается в коде, JSON-файлом или PUT /fake/orders/{number}
+package accrualfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Step - один ответ accrual. Code = 0 означает 200, Body заменяет JSON из Status и Accrual
+type Step struct {
+	Code       int      `json:"code,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Accrual    float64  `json:"accrual,omitempty"`
+	Body       string   `json:"body,omitempty"`
+	RetryAfter string   `json:"retry_after,omitempty"`
+	Latency    Duration `json:"latency,omitempty"`
+}
+
+// After задерживает ответ на d
+func (s Step) After(d time.Duration) Step {
+	s.Latency = Duration(d)
+	return s
+}
+
+func Registered() Step {
+	return Step{Status: "REGISTERED"}
+}
+
+func Processing() Step {
+	return Step{Status: "PROCESSING"}
+}
+
+func Invalid() Step {
+	return Step{Status: "INVALID"}
+}
+
+func Processed(accrual float64) Step {
+	return Step{Status: "PROCESSED", Accrual: accrual}
+}
+
+// NotRegistered - 204, заказ accrual неизвестен
+func NotRegistered() Step {
+	return Step{Code: http.StatusNoContent}
+}
+
+// TooManyRequests - 429 с Retry-After в секундах и лимитом в теле, как у настоящего accrual
+func TooManyRequests(retryAfter time.Duration, perMinute int) Step {
+	return Step{
+		Code:       http.StatusTooManyRequests,
+		RetryAfter: strconv.Itoa(int(retryAfter / time.Second)),
+		Body:       fmt.Sprintf("No more than %d requests per minute allowed", perMinute),
+	}
+}
+
+// Malformed - 200 с телом, которое не разобрать
+func Malformed() Step {
+	return Step{Body: `{"order":`}
+}
+
+func ServerError() Step {
+	return Step{Code: http.StatusInternalServerError, Body: "internal server error"}
+}
+
+// Duration в JSON пишется строкой time.ParseDuration: "150ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("Duration-Unmarshal-err: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("Duration-ParseDuration-err: %w", err)
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// Script - сценарии по заказам. Default - для заказов без своего сценария, пустой - всегда 204
+type Script struct {
+	Default []Step            `json:"default"`
+	Orders  map[string][]Step `json:"orders"`
+	// Latency добавляется к каждому ответу вдобавок к Step.Latency
+	Latency Duration `json:"latency"`
+}
+
+// LoadScript читает сценарий из JSON
+func LoadScript(r io.Reader) (Script, error) {
+	var script Script
+	if err := json.NewDecoder(r).Decode(&script); err != nil {
+		return Script{}, fmt.Errorf("LoadScript-Decode-err: %w", err)
+	}
+
+	return script, nil
+}
+
+// DefaultScript - заказ проходит весь путь до PROCESSED за три запроса
+var DefaultScript = Script{
+	Default: []Step{Registered(), Processing(), Processed(500)},
+}
+
+type Server struct {
+	mu     sync.Mutex
+	script Script
+	calls  map[string]int
+}
+
+func New(script Script) *Server {
+	// свой экземпляр карты: Script не должен менять сценарий, переданный снаружи
+	orders := make(map[string][]Step, len(script.Orders))
+	for orderID, steps := range script.Orders {
+		orders[orderID] = steps
+	}
+	script.Orders = orders
+
+	return &Server{script: script, calls: make(map[string]int)}
+}
+
+// Start поднимает httptest-сервер и возвращает его адрес. Сервер остановится в конце теста
+func (s *Server) Start(tb testing.TB) string {
+	tb.Helper()
+
+	ts := httptest.NewServer(s.Handler())
+	tb.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+// Script задает сценарий заказа и сбрасывает счетчик его запросов
+func (s *Server) Script(orderID string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.script.Orders[orderID] = steps
+	delete(s.calls, orderID)
+}
+
+// Calls - сколько раз спрашивали заказ
+func (s *Server) Calls(orderID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[orderID]
+}
+
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/orders/{number}", s.getOrder)
+	r.Put("/fake/orders/{number}", s.putScript)
+
+	return r
+}
+
+// next берет следующий шаг сценария заказа, nil - отвечать 204
+func (s *Server) next(orderID string) (*Step, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	steps, ok := s.script.Orders[orderID]
+	if !ok {
+		steps = s.script.Default
+	}
+
+	n := s.calls[orderID]
+	s.calls[orderID]++
+
+	if len(steps) == 0 {
+		return nil, time.Duration(s.script.Latency)
+	}
+
+	step := steps[min(n, len(steps)-1)]
+	return &step, time.Duration(s.script.Latency + step.Latency)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "number")
+	step, latency := s.next(orderID)
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if step == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	code := step.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	if step.RetryAfter != "" {
+		w.Header().Set("Retry-After", step.RetryAfter)
+	}
+
+	body := []byte(step.Body)
+	if step.Body == "" && step.Status != "" {
+		body, _ = json.Marshal(struct {
+			Order   string  `json:"order"`
+			Status  string  `json:"status"`
+			Accrual float64 `json:"accrual,omitempty"`
+		}{Order: orderID, Status: step.Status, Accrual: step.Accrual})
+		w.Header().Set("Content-Type", "application/json")
+	} else if len(body) > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// putScript меняет сценарий заказа на лету: тело - JSON-массив шагов
+func (s *Server) putScript(w http.ResponseWriter, r *http.Request) {
+	var steps []Step
+	if err := json.NewDecoder(r.Body).Decode(&steps); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Script(chi.URLParam(r, "number"), steps...)
+	w.WriteHeader(http.StatusNoContent)
+}
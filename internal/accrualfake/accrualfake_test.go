@@ -0,0 +1,86 @@
+package accrualfake
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, url string) (int, http.Header, string) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, resp.Header, string(body)
+}
+
+func TestServerScript(t *testing.T) {
+	s := New(DefaultScript)
+	url := s.Start(t)
+
+	s.Script("1", TooManyRequests(time.Minute, 10), ServerError(), Malformed(), Processed(10.5))
+
+	code, header, body := get(t, url+"/api/orders/1")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "60", header.Get("Retry-After"))
+	assert.Equal(t, "No more than 10 requests per minute allowed", body)
+
+	code, _, _ = get(t, url+"/api/orders/1")
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	code, _, body = get(t, url+"/api/orders/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"order":`, body)
+
+	// последний шаг повторяется
+	for i := 0; i < 2; i++ {
+		code, _, body = get(t, url+"/api/orders/1")
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"order":"1","status":"PROCESSED","accrual":10.5}`, body)
+	}
+	assert.Equal(t, 5, s.Calls("1"))
+
+	// заказы без сценария идут по DefaultScript
+	for _, want := range []string{"REGISTERED", "PROCESSING", "PROCESSED"} {
+		_, _, body = get(t, url+"/api/orders/2")
+		assert.Contains(t, body, want)
+	}
+}
+
+func TestServerPutScript(t *testing.T) {
+	s := New(Script{})
+	url := s.Start(t)
+
+	code, _, _ := get(t, url+"/api/orders/3")
+	assert.Equal(t, http.StatusNoContent, code, "empty default script answers 204")
+
+	req, err := http.NewRequest(http.MethodPut, url+"/fake/orders/3", strings.NewReader(`[{"status":"INVALID","latency":"10ms"}]`))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, _, body := get(t, url+"/api/orders/3")
+	assert.JSONEq(t, `{"order":"3","status":"INVALID"}`, body)
+}
+
+func TestLoadScript(t *testing.T) {
+	script, err := LoadScript(strings.NewReader(`{"latency":"5ms","orders":{"1":[{"code":204}]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, Duration(5*time.Millisecond), script.Latency)
+	assert.Equal(t, []Step{NotRegistered()}, script.Orders["1"])
+
+	_, err = LoadScript(strings.NewReader(`{"latency":"soon"}`))
+	assert.Error(t, err)
+}
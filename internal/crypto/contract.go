@@ -1,6 +1,17 @@
 package crypto
 
+// PasswordEncrypter - обратимое AES-шифрование паролей.
+// Используется только для проверки старых записей в user_auth_data, которые еще не перехешированы.
 type PasswordEncrypter interface {
 	PassEncrypt(plaintext string) (string, error)
 	PassDecrypt(encrypted string) (string, error)
 }
+
+// PasswordHasher - необратимое хеширование паролей.
+// Параметры алгоритма хранятся в самой строке хеша, поэтому Verify умеет проверять хеши
+// любого поддерживаемого алгоритма, а NeedsRehash сообщает, что хеш пора пересчитать с текущими параметрами.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
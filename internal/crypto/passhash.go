@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgoArgon2id = "argon2id"
+	HashAlgoBcrypt   = "bcrypt"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	argon2SaltLen  = 16
+	argon2KeyLen   = 32
+)
+
+// ErrUnknownHashFormat - строка не похожа ни на один из поддерживаемых хешей (например, это старый AES-шифротекст)
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Argon2Params - параметры argon2id, см. RFC 9106
+type Argon2Params struct {
+	Memory      uint32 // в KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  1,
+	Parallelism: 4,
+}
+
+type hasher struct {
+	algo         string
+	argon2Params Argon2Params
+	bcryptCost   int
+}
+
+// HasherOption описывает функциональную опцию для конфигурации хешера.
+type HasherOption func(*hasher)
+
+// WithArgon2Params задает параметры argon2id для новых хешей.
+func WithArgon2Params(p Argon2Params) HasherOption {
+	return func(h *hasher) {
+		h.argon2Params = p
+	}
+}
+
+// WithBcryptCost задает cost для новых bcrypt хешей.
+func WithBcryptCost(cost int) HasherOption {
+	return func(h *hasher) {
+		h.bcryptCost = cost
+	}
+}
+
+// NewPasswordHasher создает хешер, который хеширует новые пароли алгоритмом algo
+func NewPasswordHasher(algo string, options ...HasherOption) (*hasher, error) {
+	if algo != HashAlgoArgon2id && algo != HashAlgoBcrypt {
+		return nil, fmt.Errorf("NewPasswordHasher unsupported algorithm: %q", algo)
+	}
+
+	h := &hasher{
+		algo:         algo,
+		argon2Params: DefaultArgon2Params,
+		bcryptCost:   bcrypt.DefaultCost,
+	}
+
+	for _, opt := range options {
+		opt(h)
+	}
+
+	return h, nil
+}
+
+// Hash хеширует пароль текущим алгоритмом. Результат содержит алгоритм, параметры и соль.
+func (h hasher) Hash(password string) (string, error) {
+	if h.algo == HashAlgoBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("Hash bcrypt-err: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("Hash rand.Read-err: %w", err)
+	}
+
+	p := h.argon2Params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify сравнивает пароль с хешем за постоянное время.
+// Для строк неизвестного формата возвращает ErrUnknownHashFormat.
+func (h hasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		otherKey := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("Verify bcrypt-err: %w", err)
+		}
+		return true, nil
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+// NeedsRehash сообщает, что хеш сделан другим алгоритмом или с другими параметрами
+func (h hasher) NeedsRehash(encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		if h.algo != HashAlgoArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2id(encoded)
+		return err != nil || p != h.argon2Params
+	case isBcrypt(encoded):
+		if h.algo != HashAlgoBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.bcryptCost
+	default:
+		return true
+	}
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id: %w", ErrUnknownHashFormat)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id version-err: %w", err)
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id unsupported version: %d", version)
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id params-err: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id salt-err: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("decodeArgon2id key-err: %w", err)
+	}
+
+	return p, salt, key, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	argon, err := NewPasswordHasher(HashAlgoArgon2id)
+	require.NoError(t, err)
+
+	bcr, err := NewPasswordHasher(HashAlgoBcrypt, WithBcryptCost(bcrypt.MinCost))
+	require.NoError(t, err)
+
+	legacy, err := NewEncrypter([]byte("myverystrongpasswordo32bitlength")).PassEncrypt("pass1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		hashedBy    *hasher
+		verifiedBy  *hasher
+		password    string
+		check       string
+		wantOK      bool
+		needsRehash bool
+	}{
+		{
+			name:       "argon2id correct password",
+			hashedBy:   argon,
+			verifiedBy: argon,
+			password:   "pass1",
+			check:      "pass1",
+			wantOK:     true,
+		},
+		{
+			name:       "argon2id wrong password",
+			hashedBy:   argon,
+			verifiedBy: argon,
+			password:   "pass1",
+			check:      "pass2",
+			wantOK:     false,
+		},
+		{
+			name:       "bcrypt correct password",
+			hashedBy:   bcr,
+			verifiedBy: bcr,
+			password:   "pass1",
+			check:      "pass1",
+			wantOK:     true,
+		},
+		{
+			name:        "bcrypt hash verified by argon2id hasher",
+			hashedBy:    bcr,
+			verifiedBy:  argon,
+			password:    "pass1",
+			check:       "pass1",
+			wantOK:      true,
+			needsRehash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hashedBy.Hash(tt.password)
+			require.NoError(t, err)
+			assert.NotContains(t, encoded, tt.password)
+
+			ok, err := tt.verifiedBy.Verify(tt.check, encoded)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.needsRehash, tt.verifiedBy.NeedsRehash(encoded))
+		})
+	}
+
+	t.Run("legacy AES row", func(t *testing.T) {
+		_, err := argon.Verify("pass1", legacy)
+		assert.ErrorIs(t, err, ErrUnknownHashFormat)
+		assert.True(t, argon.NeedsRehash(legacy))
+	})
+
+	t.Run("changed argon2id params", func(t *testing.T) {
+		stronger, err := NewPasswordHasher(HashAlgoArgon2id, WithArgon2Params(Argon2Params{Memory: 32 * 1024, Iterations: 2, Parallelism: 2}))
+		require.NoError(t, err)
+
+		encoded, err := argon.Hash("pass1")
+		require.NoError(t, err)
+		assert.True(t, stronger.NeedsRehash(encoded))
+	})
+}
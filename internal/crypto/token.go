@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const tokenBytes = 32
+
+// NewToken генерирует случайный непрозрачный токен и его хеш.
+// Юзеру отдается сам токен, в базе хранится только хеш.
+func NewToken() (token, hash string, err error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("NewToken rand.Read-err: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken хеширует случайный токен. У токенов достаточно энтропии, поэтому медленный хеш не нужен
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP по RFC 6238 в том виде, который понимают все приложения-аутентификаторы
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+
+	totpSecretBytes   = 20
+	recoveryCodeBytes = 10
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret генерирует секрет для TOTP в base32, как его ожидают аутентификаторы
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("NewTOTPSecret rand.Read-err: %w", err)
+	}
+
+	return b32.EncodeToString(buf), nil
+}
+
+// TOTPURI собирает otpauth:// ссылку для QR-кода
+func TOTPURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPStep - номер 30-секундного интервала, на котором основан код
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode вычисляет код для интервала step (HOTP из RFC 4226)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("TOTPCode DecodeString-err: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// ValidateTOTP проверяет код с допуском skew интервалов в обе стороны на рассинхрон часов.
+// Возвращает интервал, которому соответствует код: его нужно запомнить, чтобы код нельзя было использовать повторно.
+func ValidateTOTP(secret, code string, now time.Time, skew int) (int64, bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false, nil
+	}
+
+	current := TOTPStep(now)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// NewRecoveryCode генерирует одноразовый код восстановления вида abcde-fghij.
+// Как и с токенами, в базе хранится только HashToken от кода
+func NewRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("NewRecoveryCode rand.Read-err: %w", err)
+	}
+
+	code := strings.ToLower(b32.EncodeToString(buf))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// NormalizeRecoveryCode приводит введенный юзером код восстановления к виду, в котором он хешировался
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// тестовые векторы SHA1 из RFC 6238, последние 6 цифр
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "time: %d", tt.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	prev, err := TOTPCode(secret, step-1)
+	require.NoError(t, err)
+
+	got, ok, err := ValidateTOTP(secret, prev, now, 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, got)
+
+	old, err := TOTPCode(secret, step-2)
+	require.NoError(t, err)
+
+	_, ok, err = ValidateTOTP(secret, old, now, 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = ValidateTOTP(secret, "12345", now, 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Gophermart", "user 1", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Gophermart:user 1", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Gophermart", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := NewRecoveryCode()
+	require.NoError(t, err)
+
+	assert.Len(t, code, 11)
+	assert.Equal(t, "-", code[5:6])
+	assert.Equal(t, code, NormalizeRecoveryCode(" "+strings.ToUpper(code)+" "))
+}
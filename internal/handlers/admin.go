@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// findUser ищет юзера по логину: GET /api/admin/users?login=...
+func (h *GmHandler) findUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		login := r.URL.Query().Get("login")
+		if login == "" {
+			logger.Log.Info("findUser empty login")
+			http.Error(w, "login is required", http.StatusBadRequest)
+			return
+		}
+
+		user, err := h.gmService.FindUser(ctx, login)
+		if err != nil {
+			if errors.Is(err, model.ErrUserNotFound) {
+				logger.Log.Info("findUser FindUser error", zap.String("login", login), zap.String("error", err.Error()))
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.Error("findUser FindUser error", zap.String("login", login), zap.String("error", err.Error()))
+			http.Error(w, "findUser error", http.StatusInternalServerError)
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+// getUser отдает юзера, которого нашел adminTargetUser
+func (h *GmHandler) getUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(targetUserKey).(model.User)
+		if !ok {
+			logger.Log.Error("getUser get target user from context error")
+			http.Error(w, "getUser get target user from context error", http.StatusInternalServerError)
+			return
+		}
+
+		writeUser(w, user)
+	}
+}
+
+func (h *GmHandler) setUserRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("setUserRole get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "setUserRole get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("setUserRole reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "setUserRole reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.RoleRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("setUserRole unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "setUserRole unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		err = h.gmService.SetUserRole(ctx, userID, req.Role)
+		if err != nil {
+			if errors.Is(err, model.ErrUnknownRole) {
+				logger.Log.Info("setUserRole SetUserRole error", zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.Log.Error("setUserRole SetUserRole error", zap.String("error", err.Error()))
+			http.Error(w, "setUserRole error", http.StatusInternalServerError)
+			return
+		}
+
+		actorID, _ := r.Context().Value(model.ActorIDKey).(int64)
+		logger.Log.Info("user role changed", zap.Int64("user_id", userID), zap.String("role", req.Role), zap.Int64("actor_id", actorID))
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// adjustBalance вручную начисляет или списывает баллы юзеру с обязательной причиной и заметкой
+func (h *GmHandler) adjustBalance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("adjustBalance get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "adjustBalance get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		actorID, ok := ctx.Value(model.ActorIDKey).(int64)
+		if !ok {
+			logger.Log.Error("adjustBalance get actor_id from context error")
+			http.Error(w, "adjustBalance get actor_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("adjustBalance reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "adjustBalance reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.BalanceAdjustmentRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("adjustBalance unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "adjustBalance unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		adj, err := h.gmService.AdjustBalance(ctx, actorID, userID, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrZeroAdjustment),
+				errors.Is(err, model.ErrUnknownAdjustmentReason),
+				errors.Is(err, model.ErrEmptyAdjustmentNote):
+				logger.Log.Info("adjustBalance AdjustBalance error", zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, model.ErrSelfAdjustment):
+				logger.Log.Warn("adjustBalance AdjustBalance error", zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, model.ErrNotEnoughMoney):
+				logger.Log.Info("adjustBalance AdjustBalance error", zap.String("error", err.Error()))
+				http.Error(w, "not enough money", http.StatusPaymentRequired)
+			default:
+				logger.Log.Error("adjustBalance AdjustBalance error", zap.String("error", err.Error()))
+				http.Error(w, "adjustBalance error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp, err := json.Marshal(adj)
+		if err != nil {
+			http.Error(w, "adjustBalance marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(resp)
+	}
+}
+
+// getBalanceAdjustments отдает аудит ручных корректировок баланса юзера
+func (h *GmHandler) getBalanceAdjustments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("getBalanceAdjustments get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "getBalanceAdjustments get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		adjustments, err := h.gmService.GetBalanceAdjustments(ctx, userID)
+		if err != nil {
+			logger.Log.Error("getBalanceAdjustments error", zap.String("error", err.Error()))
+			http.Error(w, "getBalanceAdjustments error", http.StatusInternalServerError)
+			return
+		}
+
+		if len(adjustments) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resp, err := json.Marshal(adjustments)
+		if err != nil {
+			http.Error(w, "getBalanceAdjustments marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+// getDeadLetterOrders отдает заказы, по которым accrual исчерпал попытки
+func (h *GmHandler) getDeadLetterOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orders, err := h.gmService.GetDeadLetterOrders(r.Context())
+		if err != nil {
+			logger.Log.Error("getDeadLetterOrders error", zap.String("error", err.Error()))
+			http.Error(w, "getDeadLetterOrders error", http.StatusInternalServerError)
+			return
+		}
+
+		if len(orders) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resp, err := json.Marshal(orders)
+		if err != nil {
+			http.Error(w, "getDeadLetterOrders marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+// requeueOrder возвращает заказ из dead letter в очередь accrual
+func (h *GmHandler) requeueOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		actorID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("requeueOrder get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "requeueOrder get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		orderID := chi.URLParam(r, "number")
+
+		err = h.gmService.RequeueOrder(ctx, actorID, orderID)
+		if err != nil {
+			if errors.Is(err, model.ErrOrderNotDeadLettered) {
+				logger.Log.Info("requeueOrder RequeueOrder error", zap.String("order_id", orderID), zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			logger.Log.Error("requeueOrder RequeueOrder error", zap.String("order_id", orderID), zap.String("error", err.Error()))
+			http.Error(w, "requeueOrder error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// getAccrualBreaker отдает состояние circuit breaker клиента accrual
+func (h *GmHandler) getAccrualBreaker() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.accrualBreaker == nil {
+			http.Error(w, "accrual breaker is not configured", http.StatusNotFound)
+			return
+		}
+
+		resp, err := json.Marshal(h.accrualBreaker.BreakerStatus())
+		if err != nil {
+			http.Error(w, "getAccrualBreaker marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+// requireWorkerPool отвечает 404, если пул не передан в WithWorkerPool
+func (h *GmHandler) requireWorkerPool(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.workerPool == nil {
+			http.Error(w, "worker pool is not configured", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getWorkerPool отдает состояние пула воркеров accrual
+func (h *GmHandler) getWorkerPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeWorkerPool(w, h.workerPool.Status())
+	}
+}
+
+func (h *GmHandler) pauseWorkerPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.workerPool.Pause()
+
+		actorID, _ := userIDFromContext(r)
+		logger.Log.Info("worker pool paused", zap.Int64("actor_id", actorID))
+
+		writeWorkerPool(w, h.workerPool.Status())
+	}
+}
+
+func (h *GmHandler) resumeWorkerPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.workerPool.Resume()
+
+		actorID, _ := userIDFromContext(r)
+		logger.Log.Info("worker pool resumed", zap.Int64("actor_id", actorID))
+
+		writeWorkerPool(w, h.workerPool.Status())
+	}
+}
+
+// resizeWorkerPool меняет границы пула: {"min": 2, "max": 8}
+func (h *GmHandler) resizeWorkerPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("resizeWorkerPool reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "resizeWorkerPool reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.WorkerPoolSizeRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("resizeWorkerPool unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "resizeWorkerPool unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		err = h.workerPool.Resize(req.Min, req.Max)
+		if err != nil {
+			if errors.Is(err, model.ErrInvalidPoolSize) {
+				logger.Log.Info("resizeWorkerPool Resize error", zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.Log.Error("resizeWorkerPool Resize error", zap.String("error", err.Error()))
+			http.Error(w, "resizeWorkerPool error", http.StatusInternalServerError)
+			return
+		}
+
+		actorID, _ := userIDFromContext(r)
+		logger.Log.Info("worker pool resized", zap.Int("min", req.Min), zap.Int("max", req.Max), zap.Int64("actor_id", actorID))
+
+		writeWorkerPool(w, h.workerPool.Status())
+	}
+}
+
+func writeWorkerPool(w http.ResponseWriter, status model.WorkerPoolStatus) {
+	resp, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, "marshal worker pool status error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+type adminContextKey string
+
+const targetUserKey adminContextKey = "target_user"
+
+// adminTargetUser - middleware для маршрутов /api/admin/users/{id}. Находит юзера из пути
+// и подставляет его в контекст вместо админа, чтобы переиспользовать обычные хендлеры юзера.
+// Сам админ остается в контексте под ActorIDKey
+func (h *GmHandler) adminTargetUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		actorID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("adminTargetUser get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "adminTargetUser get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			logger.Log.Info("adminTargetUser parse user id error", zap.String("error", err.Error()))
+			http.Error(w, "incorrect user id", http.StatusBadRequest)
+			return
+		}
+
+		user, err := h.gmService.GetUser(ctx, userID)
+		if err != nil {
+			if errors.Is(err, model.ErrUserNotFound) {
+				logger.Log.Info("adminTargetUser GetUser error", zap.Int64("user_id", userID), zap.String("error", err.Error()))
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.Error("adminTargetUser GetUser error", zap.Int64("user_id", userID), zap.String("error", err.Error()))
+			http.Error(w, "adminTargetUser error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx = context.WithValue(ctx, model.ActorIDKey, actorID)
+		ctx = context.WithValue(ctx, model.UserIDKey, model.ContextKey(strconv.FormatInt(user.ID, 10)))
+		ctx = context.WithValue(ctx, targetUserKey, user)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func writeUser(w http.ResponseWriter, user model.User) {
+	resp, err := json.Marshal(user)
+	if err != nil {
+		http.Error(w, "marshal user error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func (h *GmHandler) createAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("createAPIKey get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "createAPIKey get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("createAPIKey reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "createAPIKey reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.APIKeyRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("createAPIKey unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "createAPIKey unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		apiKey, err := h.gmService.CreateAPIKey(ctx, userID, req)
+		if err != nil {
+			if errors.Is(err, model.ErrUnknownScope) {
+				logger.Log.Info("createAPIKey CreateAPIKey error", zap.String("error", err.Error()))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.Log.Error("createAPIKey CreateAPIKey error", zap.String("error", err.Error()))
+			http.Error(w, "createAPIKey error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := json.Marshal(apiKey)
+		if err != nil {
+			http.Error(w, "createAPIKey marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(resp)
+	}
+}
+
+func (h *GmHandler) getAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("getAPIKeys get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "getAPIKeys get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		keys, err := h.gmService.GetAPIKeys(ctx, userID)
+		if err != nil {
+			logger.Log.Error("getAPIKeys error", zap.String("error", err.Error()))
+			http.Error(w, "getAPIKeys error", http.StatusInternalServerError)
+			return
+		}
+
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		resp, err := json.Marshal(keys)
+		if err != nil {
+			http.Error(w, "getAPIKeys marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(resp)
+	}
+}
+
+func (h *GmHandler) revokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("revokeAPIKey get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "revokeAPIKey get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		keyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "incorrect api key id", http.StatusBadRequest)
+			return
+		}
+
+		err = h.gmService.RevokeAPIKey(ctx, userID, keyID)
+		if err != nil {
+			if errors.Is(err, model.ErrAPIKeyNotFound) {
+				http.Error(w, "api key not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.Error("revokeAPIKey error", zap.String("error", err.Error()))
+			http.Error(w, "revokeAPIKey error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
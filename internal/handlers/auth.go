@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"gophermart/internal/logger"
+	"gophermart/internal/middleware"
 	"gophermart/internal/model"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -49,8 +51,17 @@ func (h *GmHandler) register() http.HandlerFunc {
 			return
 		}
 
+		refreshToken, err := h.gmService.IssueRefreshToken(ctx, userID)
+		if err != nil {
+			logger.Log.Error("register IssueRefreshToken error", zap.String("login", req.Login), zap.String("error", err.Error()))
+			http.Error(w, "register IssueRefreshToken error", http.StatusInternalServerError)
+			return
+		}
+		middleware.SetRefreshCookie(w, refreshToken, h.refreshTokenTTL)
+
 		// закидываем юзера в хедеры чтоб потом навесить куку
 		w.Header().Set(string(model.UserIDKey), strconv.FormatInt(userID, 10))
+		w.Header().Set(string(model.UserRoleKey), model.RoleUser)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -76,15 +87,17 @@ func (h *GmHandler) login() http.HandlerFunc {
 			return
 		}
 
-		userID, err := h.gmService.GetAuthInfo(ctx, req.Login, req.Password)
+		userID, err := h.gmService.GetAuthInfo(ctx, req.Login, req.Password, clientIP(r))
 		if err != nil {
-			if errors.Is(err, model.ErrWrongLogin) {
+			var lockedErr model.LoginLockedError
+			// несуществующий логин и неверный пароль неразличимы снаружи, чтобы нельзя было перебирать логины
+			if errors.Is(err, model.ErrWrongLogin) || errors.Is(err, model.ErrWrongPas) {
 				logger.Log.Error("login GetAuthInfo error", zap.String("login", req.Login), zap.String("error", err.Error()))
-				http.Error(w, "login does not exist", http.StatusUnauthorized)
+				http.Error(w, "wrong login or password", http.StatusUnauthorized)
 				return
-			} else if errors.Is(err, model.ErrWrongPas) {
-				logger.Log.Error("login GetAuthInfo error", zap.String("login", req.Login), zap.String("error", err.Error()))
-				http.Error(w, "wrong password", http.StatusUnauthorized)
+			} else if errors.As(err, &lockedErr) {
+				logger.Log.Warn("login GetAuthInfo error", zap.String("login", req.Login), zap.String("error", err.Error()))
+				writeLoginLocked(w, lockedErr)
 				return
 			} else {
 				logger.Log.Error("login GetAuthInfo error", zap.String("login", req.Login), zap.String("error", err.Error()))
@@ -93,10 +106,62 @@ func (h *GmHandler) login() http.HandlerFunc {
 			}
 		}
 
-		// закидываем юзера в хедеры чтоб потом навесить куку
-		w.Header().Set(string(model.UserIDKey), strconv.FormatInt(userID, 10))
+		// с включенной 2FA куки выдаются только после второго шага
+		challenge, err := h.gmService.BeginSecondFactor(ctx, userID)
+		if err != nil {
+			logger.Log.Error("login BeginSecondFactor error", zap.String("login", req.Login), zap.String("error", err.Error()))
+			http.Error(w, "login BeginSecondFactor error", http.StatusInternalServerError)
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		if challenge != "" {
+			resp, err := json.Marshal(model.LoginChallenge{MFARequired: true, Token: challenge})
+			if err != nil {
+				http.Error(w, "login marshal response error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write(resp)
+			return
+		}
+
+		h.completeLogin(w, r, userID)
+	}
+}
+
+// completeLogin выдает refresh-токен и через WithMakeAuth - куку с access-токеном
+func (h *GmHandler) completeLogin(w http.ResponseWriter, r *http.Request, userID int64) {
+	role, err := h.gmService.GetUserRole(r.Context(), userID)
+	if err != nil {
+		logger.Log.Error("completeLogin GetUserRole error", zap.Int64("user_id", userID), zap.String("error", err.Error()))
+		http.Error(w, "completeLogin GetUserRole error", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := h.gmService.IssueRefreshToken(r.Context(), userID)
+	if err != nil {
+		logger.Log.Error("completeLogin IssueRefreshToken error", zap.Int64("user_id", userID), zap.String("error", err.Error()))
+		http.Error(w, "completeLogin IssueRefreshToken error", http.StatusInternalServerError)
+		return
+	}
+	middleware.SetRefreshCookie(w, refreshToken, h.refreshTokenTTL)
+
+	// закидываем юзера и его роль в хедеры чтоб потом навесить куку
+	w.Header().Set(string(model.UserIDKey), strconv.FormatInt(userID, 10))
+	w.Header().Set(string(model.UserRoleKey), role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientIP - адрес клиента для блокировки перебора. Заголовкам X-Forwarded-For не доверяем,
+// их может подставить сам атакующий
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
 }
@@ -52,6 +52,49 @@ func (h *GmHandler) getBalance() http.HandlerFunc {
 	}
 }
 
+func (h *GmHandler) getBalanceHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, ok := ctx.Value(model.UserIDKey).(model.ContextKey)
+		if !ok {
+			logger.Log.Error("getBalanceHistory get user_id from context error")
+			http.Error(w, "getBalanceHistory get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		userInt64, err := strconv.ParseInt(string(userID), 10, 64)
+		if err != nil {
+			logger.Log.Error("getBalanceHistory parse user_id to int64", zap.String("error", err.Error()))
+			http.Error(w, "getBalanceHistory parse user_id to int64", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		entries, err := h.gmService.GetBalanceHistory(ctx, userInt64)
+		if err != nil {
+			logger.Log.Error("getBalanceHistory error", zap.String("error", err.Error()))
+			http.Error(w, "getBalanceHistory error", http.StatusInternalServerError)
+			return
+		}
+
+		if len(entries) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		resp, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, "getBalanceHistory marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(resp)
+	}
+}
+
 func (h *GmHandler) withdraw() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -71,6 +114,12 @@ func (h *GmHandler) withdraw() http.HandlerFunc {
 			return
 		}
 
+		if !req.Sum.IsPositive() {
+			logger.Log.Error("withdraw incorrect sum", zap.String("sum", req.Sum.String()))
+			http.Error(w, "incorrect sum", http.StatusUnprocessableEntity)
+			return
+		}
+
 		isCorrect, err := luhnalgorithm.LuhnCheck(req.OrderID)
 		if err != nil && errors.Is(err, model.ErrNotANumber) {
 			logger.Log.Error("withdraw LuhnCheck error", zap.String("error", err.Error()))
@@ -102,6 +151,16 @@ func (h *GmHandler) withdraw() http.HandlerFunc {
 
 		req.UserID = userInt64
 
+		// юзер мог потребовать подтверждать списания кодом второго фактора
+		err = h.gmService.CheckWithdrawStepUp(ctx, userInt64, r.Header.Get(model.OTPCodeHeader))
+		if err != nil {
+			if !secondFactorError(w, err, "withdraw") {
+				logger.Log.Error("withdraw CheckWithdrawStepUp error", zap.String("error", err.Error()))
+				http.Error(w, "withdraw CheckWithdrawStepUp error", http.StatusInternalServerError)
+			}
+			return
+		}
+
 		err = h.gmService.Withdraw(ctx, req)
 		if err != nil {
 			if errors.Is(err, model.ErrOrderAlreadyUploaded) {
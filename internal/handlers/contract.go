@@ -3,14 +3,53 @@ package handlers
 import (
 	"context"
 	"gophermart/internal/model"
+	"time"
 )
 
 type gmService interface {
 	AddAuthInfo(ctx context.Context, login, pass string) (int64, error)
-	GetAuthInfo(ctx context.Context, login, pass string) (int64, error)
+	GetAuthInfo(ctx context.Context, login, pass, ip string) (int64, error)
+	IssueRefreshToken(ctx context.Context, userID int64) (string, error)
+	RefreshToken(ctx context.Context, refreshToken string) (int64, string, error)
+	Logout(ctx context.Context, refreshToken string) error
+	CreateAPIKey(ctx context.Context, userID int64, req model.APIKeyRequest) (model.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID int64) error
+	AuthenticateAPIKey(ctx context.Context, key string) (int64, []string, error)
+	TokensValidAfter(ctx context.Context, userID int64) (time.Time, error)
+	ChangePassword(ctx context.Context, userID int64, currentPass, newPass string) error
+	ResetPassword(ctx context.Context, token, newPass string) error
+	GetUser(ctx context.Context, userID int64) (model.User, error)
+	FindUser(ctx context.Context, login string) (model.User, error)
+	GetUserRole(ctx context.Context, userID int64) (string, error)
+	SetUserRole(ctx context.Context, userID int64, role string) error
+	AdjustBalance(ctx context.Context, actorID, userID int64, req model.BalanceAdjustmentRequest) (model.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, userID int64) ([]model.BalanceAdjustment, error)
+	GetDeadLetterOrders(ctx context.Context) ([]model.DeadLetterOrder, error)
+	RequeueOrder(ctx context.Context, actorID int64, orderID string) error
+	SetupTOTP(ctx context.Context, userID int64) (model.TOTPSetup, error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error)
+	SetWithdrawStepUp(ctx context.Context, userID int64, required bool, code string) error
+	CheckWithdrawStepUp(ctx context.Context, userID int64, code string) error
+	BeginSecondFactor(ctx context.Context, userID int64) (string, error)
+	CompleteSecondFactor(ctx context.Context, challenge, code string) (int64, error)
 	AddOrder(ctx context.Context, orderID string, userID int64) error
 	GetOrders(ctx context.Context, userID int64) ([]model.Order, error)
+	GetOrder(ctx context.Context, userID int64, orderID string) (model.OrderDetails, error)
 	GetBalance(ctx context.Context, userID int64) (model.Balance, error)
+	GetBalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error)
 	Withdraw(ctx context.Context, withdraw model.Withdraw) error
 	GetWithdrawals(ctx context.Context, userID int64) ([]model.Withdraw, error)
 }
+
+type accrualBreaker interface {
+	BreakerStatus() model.CircuitBreakerStatus
+}
+
+type workerPool interface {
+	Status() model.WorkerPoolStatus
+	Pause()
+	Resume()
+	Resize(minWorkers, maxWorkers int) error
+}
@@ -8,6 +8,7 @@ import (
 	context "context"
 	model "gophermart/internal/model"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -64,19 +65,168 @@ func (mr *MockgmServiceMockRecorder) AddOrder(ctx, orderID, userID interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockgmService)(nil).AddOrder), ctx, orderID, userID)
 }
 
+// AdjustBalance mocks base method.
+func (m *MockgmService) AdjustBalance(ctx context.Context, actorID, userID int64, req model.BalanceAdjustmentRequest) (model.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", ctx, actorID, userID, req)
+	ret0, _ := ret[0].(model.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockgmServiceMockRecorder) AdjustBalance(ctx, actorID, userID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockgmService)(nil).AdjustBalance), ctx, actorID, userID, req)
+}
+
+// AuthenticateAPIKey mocks base method.
+func (m *MockgmService) AuthenticateAPIKey(ctx context.Context, key string) (int64, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthenticateAPIKey", ctx, key)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AuthenticateAPIKey indicates an expected call of AuthenticateAPIKey.
+func (mr *MockgmServiceMockRecorder) AuthenticateAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthenticateAPIKey", reflect.TypeOf((*MockgmService)(nil).AuthenticateAPIKey), ctx, key)
+}
+
+// BeginSecondFactor mocks base method.
+func (m *MockgmService) BeginSecondFactor(ctx context.Context, userID int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginSecondFactor", ctx, userID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BeginSecondFactor indicates an expected call of BeginSecondFactor.
+func (mr *MockgmServiceMockRecorder) BeginSecondFactor(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginSecondFactor", reflect.TypeOf((*MockgmService)(nil).BeginSecondFactor), ctx, userID)
+}
+
+// ChangePassword mocks base method.
+func (m *MockgmService) ChangePassword(ctx context.Context, userID int64, currentPass, newPass string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, userID, currentPass, newPass)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockgmServiceMockRecorder) ChangePassword(ctx, userID, currentPass, newPass interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockgmService)(nil).ChangePassword), ctx, userID, currentPass, newPass)
+}
+
+// CheckWithdrawStepUp mocks base method.
+func (m *MockgmService) CheckWithdrawStepUp(ctx context.Context, userID int64, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckWithdrawStepUp", ctx, userID, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckWithdrawStepUp indicates an expected call of CheckWithdrawStepUp.
+func (mr *MockgmServiceMockRecorder) CheckWithdrawStepUp(ctx, userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckWithdrawStepUp", reflect.TypeOf((*MockgmService)(nil).CheckWithdrawStepUp), ctx, userID, code)
+}
+
+// CompleteSecondFactor mocks base method.
+func (m *MockgmService) CompleteSecondFactor(ctx context.Context, challenge, code string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteSecondFactor", ctx, challenge, code)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteSecondFactor indicates an expected call of CompleteSecondFactor.
+func (mr *MockgmServiceMockRecorder) CompleteSecondFactor(ctx, challenge, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteSecondFactor", reflect.TypeOf((*MockgmService)(nil).CompleteSecondFactor), ctx, challenge, code)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockgmService) ConfirmTOTP(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", ctx, userID, code)
+	ret0, _ := ret[0].(model.RecoveryCodes)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockgmServiceMockRecorder) ConfirmTOTP(ctx, userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockgmService)(nil).ConfirmTOTP), ctx, userID, code)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockgmService) CreateAPIKey(ctx context.Context, userID int64, req model.APIKeyRequest) (model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, userID, req)
+	ret0, _ := ret[0].(model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockgmServiceMockRecorder) CreateAPIKey(ctx, userID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockgmService)(nil).CreateAPIKey), ctx, userID, req)
+}
+
+// FindUser mocks base method.
+func (m *MockgmService) FindUser(ctx context.Context, login string) (model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUser", ctx, login)
+	ret0, _ := ret[0].(model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUser indicates an expected call of FindUser.
+func (mr *MockgmServiceMockRecorder) FindUser(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockgmService)(nil).FindUser), ctx, login)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockgmService) GetAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockgmServiceMockRecorder) GetAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockgmService)(nil).GetAPIKeys), ctx, userID)
+}
+
 // GetAuthInfo mocks base method.
-func (m *MockgmService) GetAuthInfo(ctx context.Context, login, pass string) (int64, error) {
+func (m *MockgmService) GetAuthInfo(ctx context.Context, login, pass, ip string) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAuthInfo", ctx, login, pass)
+	ret := m.ctrl.Call(m, "GetAuthInfo", ctx, login, pass, ip)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAuthInfo indicates an expected call of GetAuthInfo.
-func (mr *MockgmServiceMockRecorder) GetAuthInfo(ctx, login, pass interface{}) *gomock.Call {
+func (mr *MockgmServiceMockRecorder) GetAuthInfo(ctx, login, pass, ip interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthInfo", reflect.TypeOf((*MockgmService)(nil).GetAuthInfo), ctx, login, pass)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthInfo", reflect.TypeOf((*MockgmService)(nil).GetAuthInfo), ctx, login, pass, ip)
 }
 
 // GetBalance mocks base method.
@@ -94,6 +244,66 @@ func (mr *MockgmServiceMockRecorder) GetBalance(ctx, userID interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockgmService)(nil).GetBalance), ctx, userID)
 }
 
+// GetBalanceAdjustments mocks base method.
+func (m *MockgmService) GetBalanceAdjustments(ctx context.Context, userID int64) ([]model.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceAdjustments", ctx, userID)
+	ret0, _ := ret[0].([]model.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceAdjustments indicates an expected call of GetBalanceAdjustments.
+func (mr *MockgmServiceMockRecorder) GetBalanceAdjustments(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceAdjustments", reflect.TypeOf((*MockgmService)(nil).GetBalanceAdjustments), ctx, userID)
+}
+
+// GetBalanceHistory mocks base method.
+func (m *MockgmService) GetBalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceHistory", ctx, userID)
+	ret0, _ := ret[0].([]model.LedgerEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceHistory indicates an expected call of GetBalanceHistory.
+func (mr *MockgmServiceMockRecorder) GetBalanceHistory(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceHistory", reflect.TypeOf((*MockgmService)(nil).GetBalanceHistory), ctx, userID)
+}
+
+// GetDeadLetterOrders mocks base method.
+func (m *MockgmService) GetDeadLetterOrders(ctx context.Context) ([]model.DeadLetterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadLetterOrders", ctx)
+	ret0, _ := ret[0].([]model.DeadLetterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadLetterOrders indicates an expected call of GetDeadLetterOrders.
+func (mr *MockgmServiceMockRecorder) GetDeadLetterOrders(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadLetterOrders", reflect.TypeOf((*MockgmService)(nil).GetDeadLetterOrders), ctx)
+}
+
+// GetOrder mocks base method.
+func (m *MockgmService) GetOrder(ctx context.Context, userID int64, orderID string) (model.OrderDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", ctx, userID, orderID)
+	ret0, _ := ret[0].(model.OrderDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockgmServiceMockRecorder) GetOrder(ctx, userID, orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockgmService)(nil).GetOrder), ctx, userID, orderID)
+}
+
 // GetOrders mocks base method.
 func (m *MockgmService) GetOrders(ctx context.Context, userID int64) ([]model.Order, error) {
 	m.ctrl.T.Helper()
@@ -109,6 +319,36 @@ func (mr *MockgmServiceMockRecorder) GetOrders(ctx, userID interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrders", reflect.TypeOf((*MockgmService)(nil).GetOrders), ctx, userID)
 }
 
+// GetUser mocks base method.
+func (m *MockgmService) GetUser(ctx context.Context, userID int64) (model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, userID)
+	ret0, _ := ret[0].(model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockgmServiceMockRecorder) GetUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockgmService)(nil).GetUser), ctx, userID)
+}
+
+// GetUserRole mocks base method.
+func (m *MockgmService) GetUserRole(ctx context.Context, userID int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserRole", ctx, userID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserRole indicates an expected call of GetUserRole.
+func (mr *MockgmServiceMockRecorder) GetUserRole(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserRole", reflect.TypeOf((*MockgmService)(nil).GetUserRole), ctx, userID)
+}
+
 // GetWithdrawals mocks base method.
 func (m *MockgmService) GetWithdrawals(ctx context.Context, userID int64) ([]model.Withdraw, error) {
 	m.ctrl.T.Helper()
@@ -124,6 +364,166 @@ func (mr *MockgmServiceMockRecorder) GetWithdrawals(ctx, userID interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockgmService)(nil).GetWithdrawals), ctx, userID)
 }
 
+// IssueRefreshToken mocks base method.
+func (m *MockgmService) IssueRefreshToken(ctx context.Context, userID int64) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueRefreshToken", ctx, userID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueRefreshToken indicates an expected call of IssueRefreshToken.
+func (mr *MockgmServiceMockRecorder) IssueRefreshToken(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueRefreshToken", reflect.TypeOf((*MockgmService)(nil).IssueRefreshToken), ctx, userID)
+}
+
+// Logout mocks base method.
+func (m *MockgmService) Logout(ctx context.Context, refreshToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", ctx, refreshToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockgmServiceMockRecorder) Logout(ctx, refreshToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockgmService)(nil).Logout), ctx, refreshToken)
+}
+
+// RefreshToken mocks base method.
+func (m *MockgmService) RefreshToken(ctx context.Context, refreshToken string) (int64, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshToken", ctx, refreshToken)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RefreshToken indicates an expected call of RefreshToken.
+func (mr *MockgmServiceMockRecorder) RefreshToken(ctx, refreshToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockgmService)(nil).RefreshToken), ctx, refreshToken)
+}
+
+// RegenerateRecoveryCodes mocks base method.
+func (m *MockgmService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegenerateRecoveryCodes", ctx, userID, code)
+	ret0, _ := ret[0].(model.RecoveryCodes)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegenerateRecoveryCodes indicates an expected call of RegenerateRecoveryCodes.
+func (mr *MockgmServiceMockRecorder) RegenerateRecoveryCodes(ctx, userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegenerateRecoveryCodes", reflect.TypeOf((*MockgmService)(nil).RegenerateRecoveryCodes), ctx, userID, code)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockgmService) RequeueOrder(ctx context.Context, actorID int64, orderID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", ctx, actorID, orderID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockgmServiceMockRecorder) RequeueOrder(ctx, actorID, orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockgmService)(nil).RequeueOrder), ctx, actorID, orderID)
+}
+
+// ResetPassword mocks base method.
+func (m *MockgmService) ResetPassword(ctx context.Context, token, newPass string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", ctx, token, newPass)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockgmServiceMockRecorder) ResetPassword(ctx, token, newPass interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockgmService)(nil).ResetPassword), ctx, token, newPass)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockgmService) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, userID, keyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockgmServiceMockRecorder) RevokeAPIKey(ctx, userID, keyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockgmService)(nil).RevokeAPIKey), ctx, userID, keyID)
+}
+
+// SetUserRole mocks base method.
+func (m *MockgmService) SetUserRole(ctx context.Context, userID int64, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockgmServiceMockRecorder) SetUserRole(ctx, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockgmService)(nil).SetUserRole), ctx, userID, role)
+}
+
+// SetWithdrawStepUp mocks base method.
+func (m *MockgmService) SetWithdrawStepUp(ctx context.Context, userID int64, required bool, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWithdrawStepUp", ctx, userID, required, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWithdrawStepUp indicates an expected call of SetWithdrawStepUp.
+func (mr *MockgmServiceMockRecorder) SetWithdrawStepUp(ctx, userID, required, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWithdrawStepUp", reflect.TypeOf((*MockgmService)(nil).SetWithdrawStepUp), ctx, userID, required, code)
+}
+
+// SetupTOTP mocks base method.
+func (m *MockgmService) SetupTOTP(ctx context.Context, userID int64) (model.TOTPSetup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetupTOTP", ctx, userID)
+	ret0, _ := ret[0].(model.TOTPSetup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetupTOTP indicates an expected call of SetupTOTP.
+func (mr *MockgmServiceMockRecorder) SetupTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetupTOTP", reflect.TypeOf((*MockgmService)(nil).SetupTOTP), ctx, userID)
+}
+
+// TokensValidAfter mocks base method.
+func (m *MockgmService) TokensValidAfter(ctx context.Context, userID int64) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokensValidAfter", ctx, userID)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TokensValidAfter indicates an expected call of TokensValidAfter.
+func (mr *MockgmServiceMockRecorder) TokensValidAfter(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokensValidAfter", reflect.TypeOf((*MockgmService)(nil).TokensValidAfter), ctx, userID)
+}
+
 // Withdraw mocks base method.
 func (m *MockgmService) Withdraw(ctx context.Context, withdraw model.Withdraw) error {
 	m.ctrl.T.Helper()
@@ -137,3 +537,115 @@ func (mr *MockgmServiceMockRecorder) Withdraw(ctx, withdraw interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdraw", reflect.TypeOf((*MockgmService)(nil).Withdraw), ctx, withdraw)
 }
+
+// MockaccrualBreaker is a mock of accrualBreaker interface.
+type MockaccrualBreaker struct {
+	ctrl     *gomock.Controller
+	recorder *MockaccrualBreakerMockRecorder
+}
+
+// MockaccrualBreakerMockRecorder is the mock recorder for MockaccrualBreaker.
+type MockaccrualBreakerMockRecorder struct {
+	mock *MockaccrualBreaker
+}
+
+// NewMockaccrualBreaker creates a new mock instance.
+func NewMockaccrualBreaker(ctrl *gomock.Controller) *MockaccrualBreaker {
+	mock := &MockaccrualBreaker{ctrl: ctrl}
+	mock.recorder = &MockaccrualBreakerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockaccrualBreaker) EXPECT() *MockaccrualBreakerMockRecorder {
+	return m.recorder
+}
+
+// BreakerStatus mocks base method.
+func (m *MockaccrualBreaker) BreakerStatus() model.CircuitBreakerStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BreakerStatus")
+	ret0, _ := ret[0].(model.CircuitBreakerStatus)
+	return ret0
+}
+
+// BreakerStatus indicates an expected call of BreakerStatus.
+func (mr *MockaccrualBreakerMockRecorder) BreakerStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BreakerStatus", reflect.TypeOf((*MockaccrualBreaker)(nil).BreakerStatus))
+}
+
+// MockworkerPool is a mock of workerPool interface.
+type MockworkerPool struct {
+	ctrl     *gomock.Controller
+	recorder *MockworkerPoolMockRecorder
+}
+
+// MockworkerPoolMockRecorder is the mock recorder for MockworkerPool.
+type MockworkerPoolMockRecorder struct {
+	mock *MockworkerPool
+}
+
+// NewMockworkerPool creates a new mock instance.
+func NewMockworkerPool(ctrl *gomock.Controller) *MockworkerPool {
+	mock := &MockworkerPool{ctrl: ctrl}
+	mock.recorder = &MockworkerPoolMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockworkerPool) EXPECT() *MockworkerPoolMockRecorder {
+	return m.recorder
+}
+
+// Pause mocks base method.
+func (m *MockworkerPool) Pause() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Pause")
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockworkerPoolMockRecorder) Pause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockworkerPool)(nil).Pause))
+}
+
+// Resize mocks base method.
+func (m *MockworkerPool) Resize(minWorkers, maxWorkers int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resize", minWorkers, maxWorkers)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Resize indicates an expected call of Resize.
+func (mr *MockworkerPoolMockRecorder) Resize(minWorkers, maxWorkers interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resize", reflect.TypeOf((*MockworkerPool)(nil).Resize), minWorkers, maxWorkers)
+}
+
+// Resume mocks base method.
+func (m *MockworkerPool) Resume() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Resume")
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockworkerPoolMockRecorder) Resume() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockworkerPool)(nil).Resume))
+}
+
+// Status mocks base method.
+func (m *MockworkerPool) Status() model.WorkerPoolStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Status")
+	ret0, _ := ret[0].(model.WorkerPoolStatus)
+	return ret0
+}
+
+// Status indicates an expected call of Status.
+func (mr *MockworkerPoolMockRecorder) Status() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockworkerPool)(nil).Status))
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gophermart/internal/health"
 	"gophermart/internal/middleware"
 	"gophermart/internal/model"
 	"io"
@@ -24,6 +27,12 @@ const (
 	cookieName          = "authToken"
 )
 
+func testKeyring(t *testing.T) *middleware.Keyring {
+	keyring, err := middleware.LoadKeyring("", "", defaultSignatureKey)
+	require.NoError(t, err)
+	return keyring
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body interface{}, userID string) (*http.Response, string) {
 	var reqBody io.Reader = nil
 
@@ -40,7 +49,7 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string, body in
 	require.NoError(t, err)
 
 	if userID != "" {
-		authToken, err := middleware.MakeAuthToken(defaultSignatureKey, userID)
+		authToken, err := middleware.MakeAuthToken(testKeyring(t), userID, model.RoleUser, middleware.DefaultAccessTokenTTL)
 		require.NoError(t, err)
 
 		cookie := http.Cookie{Name: cookieName, Value: authToken}
@@ -60,8 +69,10 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string, body in
 func TestRouter(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockService := NewMockgmService(ctrl)
+	// пароль ни у кого не менялся - все токены действительны
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
 
-	handler, err := New(mockService, defaultSignatureKey)
+	handler, err := New(mockService, testKeyring(t))
 	require.NoError(t, err)
 
 	ts := httptest.NewServer(handler.InitRouter())
@@ -76,12 +87,22 @@ func TestRouter(t *testing.T) {
 	oneOrderByte, _ := json.Marshal(oneOrder)
 
 	balance := model.Balance{
-		Current:   500.5,
-		Withdrawn: 42,
+		Current:   model.MoneyFromMinor(50050),
+		Withdrawn: model.MoneyFromMinor(4200),
 	}
 
 	balanceByte, _ := json.Marshal(balance)
 
+	history := []model.LedgerEntry{{
+		ID:        2,
+		Kind:      model.LedgerKindAccrual,
+		Amount:    model.MoneyFromMinor(50050),
+		OrderID:   "79927398713",
+		CreatedAt: time.Now(),
+	}}
+
+	historyByte, _ := json.Marshal(history)
+
 	type want struct {
 		statusCode  int
 		contentType string
@@ -107,6 +128,7 @@ func TestRouter(t *testing.T) {
 			},
 			expectCall: func() {
 				mockService.EXPECT().AddAuthInfo(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				mockService.EXPECT().IssueRefreshToken(gomock.Any(), int64(1)).Times(1).Return("refresh1", nil)
 			},
 			want: want{
 				statusCode:  http.StatusOK,
@@ -139,7 +161,10 @@ func TestRouter(t *testing.T) {
 				Password: "pass1",
 			},
 			expectCall: func() {
-				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				mockService.EXPECT().BeginSecondFactor(gomock.Any(), int64(1)).Times(1).Return("", nil)
+				mockService.EXPECT().GetUserRole(gomock.Any(), int64(1)).Times(1).Return(model.RoleUser, nil)
+				mockService.EXPECT().IssueRefreshToken(gomock.Any(), int64(1)).Times(1).Return("refresh1", nil)
 			},
 			want: want{
 				statusCode:  http.StatusOK,
@@ -155,12 +180,12 @@ func TestRouter(t *testing.T) {
 				Password: "pass3",
 			},
 			expectCall: func() {
-				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(0), model.ErrWrongLogin)
+				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(0), model.ErrWrongLogin)
 			},
 			want: want{
 				statusCode:  http.StatusUnauthorized,
 				contentType: "text/plain; charset=utf-8",
-				respBody:    "login does not exist\n",
+				respBody:    "wrong login or password\n",
 			},
 		},
 		{
@@ -172,12 +197,29 @@ func TestRouter(t *testing.T) {
 				Password: "pass2",
 			},
 			expectCall: func() {
-				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(0), model.ErrWrongPas)
+				mockService.EXPECT().GetAuthInfo(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(int64(0), model.ErrWrongPas)
 			},
 			want: want{
 				statusCode:  http.StatusUnauthorized,
 				contentType: "text/plain; charset=utf-8",
-				respBody:    "wrong password\n",
+				respBody:    "wrong login or password\n",
+			},
+		},
+		{
+			name:   "login locked",
+			method: http.MethodPost,
+			path:   "/api/user/login",
+			body: model.LogoPass{
+				Login:    "login1",
+				Password: "pass2",
+			},
+			expectCall: func() {
+				mockService.EXPECT().GetAuthInfo(gomock.Any(), "login1", "pass2", "127.0.0.1").Times(1).Return(int64(0), model.LoginLockedError{RetryAfter: 90 * time.Second})
+			},
+			want: want{
+				statusCode:  http.StatusTooManyRequests,
+				contentType: "text/plain; charset=utf-8",
+				respBody:    "too many login attempts\n",
 			},
 		},
 		{
@@ -223,6 +265,42 @@ func TestRouter(t *testing.T) {
 				respBody:    string(oneOrderByte),
 			},
 		},
+		{
+			name:        "get order with history",
+			method:      http.MethodGet,
+			path:        "/api/user/orders/79927398713",
+			body:        nil,
+			userForAuth: "4",
+			expectCall: func() {
+				mockService.EXPECT().GetOrder(gomock.Any(), int64(4), "79927398713").Times(1).Return(model.OrderDetails{
+					Order: model.Order{Number: "79927398713", Status: model.OrderStatusProcessed, Accrual: 50050},
+					History: []model.OrderStatusChange{
+						{Status: model.OrderStatusNew},
+						{Status: model.OrderStatusProcessed},
+					},
+				}, nil)
+			},
+			want: want{
+				statusCode:  http.StatusOK,
+				contentType: "application/json",
+				respBody:    `{"number":"79927398713","status":"PROCESSED","accrual":500.5,"uploaded_at":"0001-01-01T00:00:00Z","history":[{"status":"NEW","changed_at":"0001-01-01T00:00:00Z"},{"status":"PROCESSED","changed_at":"0001-01-01T00:00:00Z"}]}`,
+			},
+		},
+		{
+			name:        "get order of another user",
+			method:      http.MethodGet,
+			path:        "/api/user/orders/12345678903",
+			body:        nil,
+			userForAuth: "4",
+			expectCall: func() {
+				mockService.EXPECT().GetOrder(gomock.Any(), int64(4), "12345678903").Times(1).Return(model.OrderDetails{}, model.ErrOrderNotFound)
+			},
+			want: want{
+				statusCode:  http.StatusNotFound,
+				contentType: "text/plain; charset=utf-8",
+				respBody:    "order not found\n",
+			},
+		},
 		{
 			name:        "get balance simple",
 			method:      http.MethodGet,
@@ -238,6 +316,35 @@ func TestRouter(t *testing.T) {
 				respBody:    string(balanceByte),
 			},
 		},
+		{
+			name:        "get balance history simple",
+			method:      http.MethodGet,
+			path:        "/api/user/balance/history",
+			body:        nil,
+			userForAuth: "4",
+			expectCall: func() {
+				mockService.EXPECT().GetBalanceHistory(gomock.Any(), int64(4)).Times(1).Return(history, nil)
+			},
+			want: want{
+				statusCode:  http.StatusOK,
+				contentType: "application/json",
+				respBody:    string(historyByte),
+			},
+		},
+		{
+			name:        "get empty balance history",
+			method:      http.MethodGet,
+			path:        "/api/user/balance/history",
+			body:        nil,
+			userForAuth: "4",
+			expectCall: func() {
+				mockService.EXPECT().GetBalanceHistory(gomock.Any(), int64(4)).Times(1).Return(nil, nil)
+			},
+			want: want{
+				statusCode:  http.StatusNoContent,
+				contentType: "application/json",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -254,3 +361,833 @@ func TestRouter(t *testing.T) {
 		assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
 	}
 }
+
+func TestRefreshAndLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	// пароль ни у кого не менялся - все токены действительны
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	doPost := func(path, refreshToken string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, nil)
+		require.NoError(t, err)
+		if refreshToken != "" {
+			req.AddCookie(&http.Cookie{Name: "refreshToken", Value: refreshToken})
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	cookieValue := func(resp *http.Response, name string) (string, bool) {
+		for _, c := range resp.Cookies() {
+			if c.Name == name {
+				return c.Value, true
+			}
+		}
+		return "", false
+	}
+
+	t.Run("refresh rotates token and issues access token", func(t *testing.T) {
+		mockService.EXPECT().RefreshToken(gomock.Any(), "refresh1").Times(1).Return(int64(4), "refresh2", nil)
+		mockService.EXPECT().GetUserRole(gomock.Any(), int64(4)).Times(1).Return(model.RoleUser, nil)
+
+		resp := doPost("/api/user/token/refresh", "refresh1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		refresh, _ := cookieValue(resp, "refreshToken")
+		assert.Equal(t, "refresh2", refresh)
+
+		access, ok := cookieValue(resp, cookieName)
+		require.True(t, ok)
+		assert.NotEmpty(t, access)
+	})
+
+	t.Run("refresh token reuse", func(t *testing.T) {
+		mockService.EXPECT().RefreshToken(gomock.Any(), "refresh1").Times(1).Return(int64(0), "", model.ErrRefreshTokenReused)
+
+		resp := doPost("/api/user/token/refresh", "refresh1")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		access, _ := cookieValue(resp, cookieName)
+		assert.Empty(t, access)
+	})
+
+	t.Run("refresh without token", func(t *testing.T) {
+		resp := doPost("/api/user/token/refresh", "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("logout revokes refresh token", func(t *testing.T) {
+		mockService.EXPECT().Logout(gomock.Any(), "refresh2").Times(1).Return(nil)
+
+		resp := doPost("/api/user/logout", "refresh2")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, ok := cookieValue(resp, "refreshToken")
+		assert.True(t, ok)
+	})
+}
+
+func TestHeaderAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	// пароль ни у кого не менялся - все токены действительны
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	bearer, err := middleware.MakeAuthToken(testKeyring(t), "4", model.RoleUser, middleware.DefaultAccessTokenTTL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		value      string
+		expectCall func()
+		statusCode int
+	}{
+		{
+			name:   "bearer token",
+			method: http.MethodGet,
+			path:   "/api/user/withdrawals",
+			header: "Authorization",
+			value:  "Bearer " + bearer,
+			expectCall: func() {
+				mockService.EXPECT().GetWithdrawals(gomock.Any(), int64(4)).Times(1).Return(nil, nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "invalid bearer token",
+			method:     http.MethodGet,
+			path:       "/api/user/withdrawals",
+			header:     "Authorization",
+			value:      "Bearer " + bearer + "x",
+			expectCall: func() {},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "api key with scope",
+			method: http.MethodGet,
+			path:   "/api/user/withdrawals",
+			header: "X-API-Key",
+			value:  "gm_key",
+			expectCall: func() {
+				mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_key").Times(1).Return(int64(5), []string{model.ScopeWithdrawalsRead}, nil)
+				mockService.EXPECT().GetWithdrawals(gomock.Any(), int64(5)).Times(1).Return(nil, nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "api key in authorization header without scope",
+			method: http.MethodPost,
+			path:   "/api/user/balance/withdraw",
+			header: "Authorization",
+			value:  "Bearer gm_key",
+			expectCall: func() {
+				mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_key").Times(1).Return(int64(5), []string{model.ScopeBalanceRead}, nil)
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "revoked api key",
+			method: http.MethodGet,
+			path:   "/api/user/orders",
+			header: "X-API-Key",
+			value:  "gm_revoked",
+			expectCall: func() {
+				mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_revoked").Times(1).Return(int64(0), nil, model.ErrInvalidAPIKey)
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "api key can not manage api keys",
+			method: http.MethodGet,
+			path:   "/api/user/api-keys",
+			header: "X-API-Key",
+			value:  "gm_key",
+			expectCall: func() {
+				mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_key").Times(1).Return(int64(5), model.Scopes, nil)
+			},
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expectCall()
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set(tt.header, tt.value)
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Empty(t, resp.Cookies(), "header auth must not set cookies")
+		})
+	}
+}
+
+func TestSecondFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	// пароль ни у кого не менялся - все токены действительны
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	t.Run("login with 2fa returns challenge without cookies", func(t *testing.T) {
+		mockService.EXPECT().GetAuthInfo(gomock.Any(), "login1", "pass1", gomock.Any()).Times(1).Return(int64(1), nil)
+		mockService.EXPECT().BeginSecondFactor(gomock.Any(), int64(1)).Times(1).Return("challenge1", nil)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/login", model.LogoPass{Login: "login1", Password: "pass1"}, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.JSONEq(t, `{"mfa_required":true,"mfa_token":"challenge1"}`, body)
+		assert.Empty(t, resp.Cookies())
+	})
+
+	t.Run("second step with valid code", func(t *testing.T) {
+		mockService.EXPECT().CompleteSecondFactor(gomock.Any(), "challenge1", "123456").Times(1).Return(int64(1), nil)
+		mockService.EXPECT().GetUserRole(gomock.Any(), int64(1)).Times(1).Return(model.RoleUser, nil)
+		mockService.EXPECT().IssueRefreshToken(gomock.Any(), int64(1)).Times(1).Return("refresh1", nil)
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/login/2fa", model.SecondFactorRequest{Token: "challenge1", Code: "123456"}, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		cookies := map[string]string{}
+		for _, c := range resp.Cookies() {
+			cookies[c.Name] = c.Value
+		}
+		assert.NotEmpty(t, cookies[cookieName])
+		assert.Equal(t, "refresh1", cookies["refreshToken"])
+	})
+
+	t.Run("second step with wrong code", func(t *testing.T) {
+		mockService.EXPECT().CompleteSecondFactor(gomock.Any(), "challenge1", "000000").Times(1).Return(int64(0), fmt.Errorf("verify: %w", model.ErrWrongTOTPCode))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/login/2fa", model.SecondFactorRequest{Token: "challenge1", Code: "000000"}, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "wrong 2fa code\n", body)
+		assert.Empty(t, resp.Cookies())
+	})
+
+	t.Run("second step locked", func(t *testing.T) {
+		mockService.EXPECT().CompleteSecondFactor(gomock.Any(), "challenge1", "000000").Times(1).Return(int64(0), model.LoginLockedError{RetryAfter: 1500 * time.Millisecond})
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/login/2fa", model.SecondFactorRequest{Token: "challenge1", Code: "000000"}, "")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("setup", func(t *testing.T) {
+		mockService.EXPECT().SetupTOTP(gomock.Any(), int64(1)).Times(1).Return(model.TOTPSetup{Secret: "ABC", URI: "otpauth://totp/Gophermart:login1?secret=ABC"}, nil)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/2fa/setup", "", "1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"secret":"ABC","otpauth_uri":"otpauth://totp/Gophermart:login1?secret=ABC"}`, body)
+	})
+
+	t.Run("setup without secret key", func(t *testing.T) {
+		mockService.EXPECT().SetupTOTP(gomock.Any(), int64(1)).Times(1).Return(model.TOTPSetup{}, model.ErrSecretEncrypterNotDefined)
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/2fa/setup", "", "1")
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+
+	t.Run("confirm with wrong code", func(t *testing.T) {
+		mockService.EXPECT().ConfirmTOTP(gomock.Any(), int64(1), "000000").Times(1).Return(model.RecoveryCodes{}, model.ErrWrongTOTPCode)
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/2fa/confirm", model.TOTPCodeRequest{Code: "000000"}, "1")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		mockService.EXPECT().ConfirmTOTP(gomock.Any(), int64(1), "123456").Times(1).Return(model.RecoveryCodes{Codes: []string{"abcde-fghij"}}, nil)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/2fa/confirm", model.TOTPCodeRequest{Code: "123456"}, "1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"recovery_codes":["abcde-fghij"]}`, body)
+	})
+
+	t.Run("withdraw requires step-up code", func(t *testing.T) {
+		mockService.EXPECT().CheckWithdrawStepUp(gomock.Any(), int64(1), "").Times(1).Return(model.ErrSecondFactorRequired)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/balance/withdraw", `{"order":"2377225624","sum":751}`, "1")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "second factor required\n", body)
+	})
+
+	t.Run("withdraw with step-up code", func(t *testing.T) {
+		mockService.EXPECT().CheckWithdrawStepUp(gomock.Any(), int64(1), "123456").Times(1).Return(nil)
+		mockService.EXPECT().Withdraw(gomock.Any(), model.Withdraw{OrderID: "2377225624", Sum: 75100, UserID: 1}).Times(1).Return(nil)
+
+		authToken, err := middleware.MakeAuthToken(testKeyring(t), "1", model.RoleUser, middleware.DefaultAccessTokenTTL)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/user/balance/withdraw", strings.NewReader(`{"order":"2377225624","sum":751}`))
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: authToken})
+		req.Header.Set(model.OTPCodeHeader, "123456")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("api key can not manage 2fa", func(t *testing.T) {
+		mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_key").Times(1).Return(int64(5), model.Scopes, nil)
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/user/2fa/setup", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "gm_key")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	t.Run("change password issues new tokens", func(t *testing.T) {
+		mockService.EXPECT().TokensValidAfter(gomock.Any(), int64(1)).Times(1).Return(time.Time{}, nil)
+		mockService.EXPECT().ChangePassword(gomock.Any(), int64(1), "old", "new").Times(1).Return(nil)
+		mockService.EXPECT().GetUserRole(gomock.Any(), int64(1)).Times(1).Return(model.RoleUser, nil)
+		mockService.EXPECT().IssueRefreshToken(gomock.Any(), int64(1)).Times(1).Return("refresh2", nil)
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/password", model.PasswordChangeRequest{CurrentPassword: "old", NewPassword: "new"}, "1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var authCookies int
+		for _, c := range resp.Cookies() {
+			if c.Name == cookieName {
+				authCookies++
+			}
+		}
+		assert.Equal(t, 1, authCookies, "only the new access token must be set")
+	})
+
+	t.Run("change password with wrong current password", func(t *testing.T) {
+		mockService.EXPECT().TokensValidAfter(gomock.Any(), int64(1)).Times(1).Return(time.Time{}, nil)
+		mockService.EXPECT().ChangePassword(gomock.Any(), int64(1), "bad", "new").Times(1).Return(model.ErrWrongPas)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/password", model.PasswordChangeRequest{CurrentPassword: "bad", NewPassword: "new"}, "1")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "wrong password\n", body)
+	})
+
+	t.Run("token issued before password change is rejected", func(t *testing.T) {
+		mockService.EXPECT().TokensValidAfter(gomock.Any(), int64(1)).Times(1).Return(time.Now().Add(time.Hour), nil)
+
+		resp, _ := testRequest(t, ts, http.MethodGet, "/api/user/withdrawals", "", "1")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("token issued after password change is accepted", func(t *testing.T) {
+		mockService.EXPECT().TokensValidAfter(gomock.Any(), int64(1)).Times(1).Return(time.Now().Add(-time.Hour), nil)
+		mockService.EXPECT().GetWithdrawals(gomock.Any(), int64(1)).Times(1).Return(nil, nil)
+
+		resp, _ := testRequest(t, ts, http.MethodGet, "/api/user/withdrawals", "", "1")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("reset password", func(t *testing.T) {
+		mockService.EXPECT().ResetPassword(gomock.Any(), "reset1", "new").Times(1).Return(nil)
+
+		resp, _ := testRequest(t, ts, http.MethodPost, "/api/user/password/reset", model.PasswordResetRequest{Token: "reset1", NewPassword: "new"}, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("reset password with used token", func(t *testing.T) {
+		mockService.EXPECT().ResetPassword(gomock.Any(), "reset1", "new").Times(1).Return(fmt.Errorf("reset: %w", model.ErrInvalidResetToken))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/user/password/reset", model.PasswordResetRequest{Token: "reset1", NewPassword: "new"}, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "invalid or expired reset token\n", body)
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	target := model.User{ID: 7, Login: "login7", Role: model.RoleUser}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		role       string
+		body       string
+		expectCall func()
+		statusCode int
+		respBody   string
+	}{
+		{
+			name:       "user is forbidden",
+			method:     http.MethodGet,
+			path:       "/api/admin/users?login=login7",
+			role:       model.RoleUser,
+			expectCall: func() {},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "support finds user by login",
+			method: http.MethodGet,
+			path:   "/api/admin/users?login=login7",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockService.EXPECT().FindUser(gomock.Any(), "login7").Times(1).Return(target, nil)
+			},
+			statusCode: http.StatusOK,
+			respBody:   `{"id":7,"login":"login7","role":"user"}`,
+		},
+		{
+			name:   "support looks up user orders",
+			method: http.MethodGet,
+			path:   "/api/admin/users/7/orders",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().GetOrders(gomock.Any(), int64(7)).Times(1).Return([]model.Order{{Number: "1234", Status: "NEW"}}, nil)
+			},
+			statusCode: http.StatusOK,
+			respBody:   `[{"number":"1234","status":"NEW","uploaded_at":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "admin looks up user balance",
+			method: http.MethodGet,
+			path:   "/api/admin/users/7/balance",
+			role:   model.RoleAdmin,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().GetBalance(gomock.Any(), int64(7)).Times(1).Return(model.Balance{Current: 50050, Withdrawn: 4200}, nil)
+			},
+			statusCode: http.StatusOK,
+			respBody:   `{"current":500.5,"withdrawn":42}`,
+		},
+		{
+			name:   "unknown user",
+			method: http.MethodGet,
+			path:   "/api/admin/users/8/withdrawals",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(8)).Times(1).Return(model.User{}, model.ErrUserNotFound)
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "support can not change roles",
+			method: http.MethodPut,
+			path:   "/api/admin/users/7/role",
+			role:   model.RoleSupport,
+			body:   `{"role":"admin"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "admin changes role",
+			method: http.MethodPut,
+			path:   "/api/admin/users/7/role",
+			role:   model.RoleAdmin,
+			body:   `{"role":"support"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().SetUserRole(gomock.Any(), int64(7), model.RoleSupport).Times(1).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "support adjusts balance",
+			method: http.MethodPost,
+			path:   "/api/admin/users/7/balance/adjustments",
+			role:   model.RoleSupport,
+			body:   `{"amount":-10.5,"reason":"fraud","note":"duplicate order"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().AdjustBalance(gomock.Any(), int64(1), int64(7), model.BalanceAdjustmentRequest{Amount: -1050, Reason: model.AdjustmentReasonFraud, Note: "duplicate order"}).
+					Times(1).Return(model.BalanceAdjustment{ID: 3, UserID: 7, ActorID: 1, Amount: -1050, Reason: model.AdjustmentReasonFraud, Note: "duplicate order"}, nil)
+			},
+			statusCode: http.StatusCreated,
+			respBody:   `{"id":3,"user_id":7,"actor_id":1,"amount":-10.5,"reason":"fraud","note":"duplicate order","created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "adjustment with unknown reason",
+			method: http.MethodPost,
+			path:   "/api/admin/users/7/balance/adjustments",
+			role:   model.RoleAdmin,
+			body:   `{"amount":10,"reason":"because","note":"x"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().AdjustBalance(gomock.Any(), int64(1), int64(7), gomock.Any()).Times(1).Return(model.BalanceAdjustment{}, model.ErrUnknownAdjustmentReason)
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "support adjusts own balance",
+			method: http.MethodPost,
+			path:   "/api/admin/users/1/balance/adjustments",
+			role:   model.RoleSupport,
+			body:   `{"amount":100,"reason":"goodwill","note":"x"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(1)).Times(1).Return(model.User{ID: 1, Login: "support", Role: model.RoleSupport}, nil)
+				mockService.EXPECT().AdjustBalance(gomock.Any(), int64(1), int64(1), gomock.Any()).Times(1).Return(model.BalanceAdjustment{}, model.ErrSelfAdjustment)
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "adjustment overdraws balance",
+			method: http.MethodPost,
+			path:   "/api/admin/users/7/balance/adjustments",
+			role:   model.RoleAdmin,
+			body:   `{"amount":-1000,"reason":"other","note":"x"}`,
+			expectCall: func() {
+				mockService.EXPECT().GetUser(gomock.Any(), int64(7)).Times(1).Return(target, nil)
+				mockService.EXPECT().AdjustBalance(gomock.Any(), int64(1), int64(7), gomock.Any()).Times(1).Return(model.BalanceAdjustment{}, model.ErrNotEnoughMoney)
+			},
+			statusCode: http.StatusPaymentRequired,
+		},
+		{
+			name:   "support lists dead letter orders",
+			method: http.MethodGet,
+			path:   "/api/admin/orders/dead-letter",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockService.EXPECT().GetDeadLetterOrders(gomock.Any()).Times(1).Return([]model.DeadLetterOrder{
+					{Number: "1234", UserID: 7, Status: model.OrderStatusNew, Attempts: 10, LastError: "incorrect responce code: 500"},
+				}, nil)
+			},
+			statusCode: http.StatusOK,
+			respBody:   `[{"number":"1234","user_id":7,"status":"NEW","attempts":10,"last_error":"incorrect responce code: 500","dead_lettered_at":"0001-01-01T00:00:00Z","uploaded_at":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "empty dead letter",
+			method: http.MethodGet,
+			path:   "/api/admin/orders/dead-letter",
+			role:   model.RoleAdmin,
+			expectCall: func() {
+				mockService.EXPECT().GetDeadLetterOrders(gomock.Any()).Times(1).Return(nil, nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "admin requeues order",
+			method: http.MethodPost,
+			path:   "/api/admin/orders/1234/requeue",
+			role:   model.RoleAdmin,
+			expectCall: func() {
+				mockService.EXPECT().RequeueOrder(gomock.Any(), int64(1), "1234").Times(1).Return(nil)
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:   "requeue order not in dead letter",
+			method: http.MethodPost,
+			path:   "/api/admin/orders/1234/requeue",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockService.EXPECT().RequeueOrder(gomock.Any(), int64(1), "1234").Times(1).Return(model.ErrOrderNotDeadLettered)
+			},
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expectCall()
+
+			authToken, err := middleware.MakeAuthToken(testKeyring(t), "1", tt.role, middleware.DefaultAccessTokenTTL)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: authToken})
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.respBody != "" {
+				assert.JSONEq(t, tt.respBody, string(body))
+			}
+		})
+	}
+
+	t.Run("api key is not allowed", func(t *testing.T) {
+		mockService.EXPECT().AuthenticateAPIKey(gomock.Any(), "gm_key").Times(1).Return(int64(1), model.Scopes, nil)
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/admin/users?login=login7", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "gm_key")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestAccrualBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+	mockBreaker := NewMockaccrualBreaker(ctrl)
+
+	openedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockBreaker.EXPECT().BreakerStatus().Times(1).Return(model.CircuitBreakerStatus{
+		State: model.BreakerStateOpen, Failures: 5, FailureThreshold: 5, OpenTimeout: "30s", OpenedAt: &openedAt,
+	})
+
+	handler, err := New(mockService, testKeyring(t), WithAccrualBreaker(mockBreaker))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	authToken, err := middleware.MakeAuthToken(testKeyring(t), "1", model.RoleSupport, middleware.DefaultAccessTokenTTL)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/admin/accrual/breaker", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: authToken})
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"state":"open","failures":5,"failure_threshold":5,"open_timeout":"30s","opened_at":"2024-05-01T12:00:00Z"}`, string(body))
+}
+
+func TestWorkerPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+	mockService.EXPECT().TokensValidAfter(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+	mockPool := NewMockworkerPool(ctrl)
+
+	handler, err := New(mockService, testKeyring(t), WithWorkerPool(mockPool))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	status := model.WorkerPoolStatus{Running: 3, Target: 3, Min: 3, Max: 10, Backlog: 12, AccrualLatency: "120ms"}
+	statusJSON := `{"running":3,"target":3,"min":3,"max":10,"paused":false,"backlog":12,"accrual_latency":"120ms"}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		role       string
+		body       string
+		expectCall func()
+		statusCode int
+		respBody   string
+	}{
+		{
+			name:   "support sees pool status",
+			method: http.MethodGet,
+			path:   "/api/admin/workers",
+			role:   model.RoleSupport,
+			expectCall: func() {
+				mockPool.EXPECT().Status().Times(1).Return(status)
+			},
+			statusCode: http.StatusOK,
+			respBody:   statusJSON,
+		},
+		{
+			name:       "support can not pause",
+			method:     http.MethodPost,
+			path:       "/api/admin/workers/pause",
+			role:       model.RoleSupport,
+			expectCall: func() {},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "admin pauses",
+			method: http.MethodPost,
+			path:   "/api/admin/workers/pause",
+			role:   model.RoleAdmin,
+			expectCall: func() {
+				mockPool.EXPECT().Pause().Times(1)
+				mockPool.EXPECT().Status().Times(1).Return(model.WorkerPoolStatus{Target: 3, Min: 3, Max: 10, Paused: true, AccrualLatency: "0s"})
+			},
+			statusCode: http.StatusOK,
+			respBody:   `{"running":0,"target":3,"min":3,"max":10,"paused":true,"backlog":0,"accrual_latency":"0s"}`,
+		},
+		{
+			name:   "admin resumes",
+			method: http.MethodPost,
+			path:   "/api/admin/workers/resume",
+			role:   model.RoleAdmin,
+			expectCall: func() {
+				mockPool.EXPECT().Resume().Times(1)
+				mockPool.EXPECT().Status().Times(1).Return(status)
+			},
+			statusCode: http.StatusOK,
+			respBody:   statusJSON,
+		},
+		{
+			name:   "admin resizes",
+			method: http.MethodPut,
+			path:   "/api/admin/workers/size",
+			role:   model.RoleAdmin,
+			body:   `{"min":2,"max":8}`,
+			expectCall: func() {
+				mockPool.EXPECT().Resize(2, 8).Times(1).Return(nil)
+				mockPool.EXPECT().Status().Times(1).Return(status)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "invalid size",
+			method: http.MethodPut,
+			path:   "/api/admin/workers/size",
+			role:   model.RoleAdmin,
+			body:   `{"min":5,"max":1}`,
+			expectCall: func() {
+				mockPool.EXPECT().Resize(5, 1).Times(1).Return(model.ErrInvalidPoolSize)
+			},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expectCall()
+
+			authToken, err := middleware.MakeAuthToken(testKeyring(t), "1", tt.role, middleware.DefaultAccessTokenTTL)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: authToken})
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.respBody != "" {
+				assert.JSONEq(t, tt.respBody, string(body))
+			}
+		})
+	}
+}
+
+func TestMetricsNotPublic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+
+	handler, err := New(mockService, testKeyring(t))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "metrics are served on METRICS_ADDRESS only")
+}
+
+func TestHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockService := NewMockgmService(ctrl)
+
+	hc := health.New(health.DefaultCheckTimeout)
+	hc.Add("db", func(ctx context.Context) error { return errors.New("db is down") })
+
+	handler, err := New(mockService, testKeyring(t), WithHealth(hc))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(handler.InitRouter())
+	defer ts.Close()
+
+	tests := []struct {
+		path       string
+		statusCode int
+		respBody   string
+	}{
+		{
+			path:       "/healthz",
+			statusCode: http.StatusOK,
+			respBody:   `{"status":"ok"}`,
+		},
+		{
+			path:       "/readyz",
+			statusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := ts.Client().Get(ts.URL + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.respBody != "" {
+				assert.JSONEq(t, tt.respBody, string(body))
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -121,3 +122,41 @@ func (h *GmHandler) getOrders() http.HandlerFunc {
 		w.Write(resp)
 	}
 }
+
+// getOrder отдает заказ юзера с историей статусов: GET /api/user/orders/{number}
+func (h *GmHandler) getOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("getOrder get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "getOrder get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		orderID := chi.URLParam(r, "number")
+
+		order, err := h.gmService.GetOrder(ctx, userID, orderID)
+		if err != nil {
+			if errors.Is(err, model.ErrOrderNotFound) {
+				logger.Log.Info("getOrder GetOrder error", zap.String("order_id", orderID), zap.String("error", err.Error()))
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.Error("getOrder GetOrder error", zap.String("order_id", orderID), zap.String("error", err.Error()))
+			http.Error(w, "getOrder error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := json.Marshal(order)
+		if err != nil {
+			http.Error(w, "getOrder marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
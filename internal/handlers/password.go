@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gophermart/internal/logger"
+	"gophermart/internal/middleware"
+	"gophermart/internal/model"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// changePassword меняет пароль по текущему. Старые токены отзываются, текущей сессии выдаются новые
+func (h *GmHandler) changePassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("changePassword get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "changePassword get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("changePassword reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "changePassword reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.PasswordChangeRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("changePassword unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "changePassword unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		err = h.gmService.ChangePassword(ctx, userID, req.CurrentPassword, req.NewPassword)
+		if err != nil {
+			var lockedErr model.LoginLockedError
+			if errors.Is(err, model.ErrEmptyPassword) {
+				logger.Log.Info("changePassword ChangePassword error", zap.String("error", err.Error()))
+				http.Error(w, "empty new password", http.StatusBadRequest)
+				return
+			} else if errors.Is(err, model.ErrWrongPas) {
+				logger.Log.Info("changePassword ChangePassword error", zap.String("error", err.Error()))
+				http.Error(w, "wrong password", http.StatusForbidden)
+				return
+			} else if errors.As(err, &lockedErr) {
+				logger.Log.Warn("changePassword ChangePassword error", zap.String("error", err.Error()))
+				writeLoginLocked(w, lockedErr)
+				return
+			} else {
+				logger.Log.Error("changePassword ChangePassword error", zap.String("error", err.Error()))
+				http.Error(w, "changePassword error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		h.completeLogin(w, r, userID)
+	}
+}
+
+// resetPassword задает новый пароль по токену сброса, полученному через нотификатор
+func (h *GmHandler) resetPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("resetPassword reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "resetPassword reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.PasswordResetRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("resetPassword unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "resetPassword unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		err = h.gmService.ResetPassword(ctx, req.Token, req.NewPassword)
+		if err != nil {
+			if errors.Is(err, model.ErrEmptyPassword) {
+				logger.Log.Info("resetPassword ResetPassword error", zap.String("error", err.Error()))
+				http.Error(w, "empty new password", http.StatusBadRequest)
+				return
+			} else if errors.Is(err, model.ErrInvalidResetToken) {
+				logger.Log.Info("resetPassword ResetPassword error", zap.String("error", err.Error()))
+				http.Error(w, "invalid or expired reset token", http.StatusUnauthorized)
+				return
+			} else {
+				logger.Log.Error("resetPassword ResetPassword error", zap.String("error", err.Error()))
+				http.Error(w, "resetPassword error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// все сессии отозваны, дальше - обычный логин
+		middleware.ClearAuthCookies(w)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+	}
+}
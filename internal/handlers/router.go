@@ -1,20 +1,72 @@
 package handlers
 
 import (
+	"errors"
+	"gophermart/internal/health"
 	"gophermart/internal/middleware"
+	"gophermart/internal/model"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
 type GmHandler struct {
-	gmService    gmService
-	signatureKey string
+	gmService       gmService
+	keyring         *middleware.Keyring
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	health          *health.Health
+	accrualBreaker  accrualBreaker
+	workerPool      workerPool
+}
+
+// Option описывает функциональную опцию для конфигурации хендлера.
+type Option func(*GmHandler)
+
+// WithTokenTTL задает время жизни access и refresh токенов.
+func WithTokenTTL(accessTokenTTL, refreshTokenTTL time.Duration) Option {
+	return func(h *GmHandler) {
+		h.accessTokenTTL = accessTokenTTL
+		h.refreshTokenTTL = refreshTokenTTL
+	}
 }
 
-func New(gmService gmService, signatureKey string) (*GmHandler, error) {
+// WithHealth задает пробы для /healthz и /readyz. Без нее readiness ничего не проверяет
+func WithHealth(hc *health.Health) Option {
+	return func(h *GmHandler) {
+		h.health = hc
+	}
+}
+
+// WithAccrualBreaker открывает админам состояние circuit breaker клиента accrual
+func WithAccrualBreaker(b accrualBreaker) Option {
+	return func(h *GmHandler) {
+		h.accrualBreaker = b
+	}
+}
+
+// WithWorkerPool открывает админам управление пулом воркеров accrual
+func WithWorkerPool(p workerPool) Option {
+	return func(h *GmHandler) {
+		h.workerPool = p
+	}
+}
+
+func New(gmService gmService, keyring *middleware.Keyring, options ...Option) (*GmHandler, error) {
 	gmHandler := &GmHandler{
-		gmService:    gmService,
-		signatureKey: signatureKey,
+		gmService:       gmService,
+		keyring:         keyring,
+		accessTokenTTL:  middleware.DefaultAccessTokenTTL,
+		refreshTokenTTL: defaultRefreshTokenTTL,
+		health:          health.New(health.DefaultCheckTimeout),
+	}
+
+	for _, opt := range options {
+		opt(gmHandler)
 	}
 
 	return gmHandler, nil
@@ -23,42 +75,136 @@ func New(gmService gmService, signatureKey string) (*GmHandler, error) {
 func (h *GmHandler) InitRouter() chi.Router {
 
 	r := chi.NewRouter()
-	r.Use(middleware.WithLogging, middleware.WithGzip)
+	r.Use(middleware.WithTracing, middleware.WithMetrics, middleware.WithLogging, middleware.WithGzip)
+
+	r.Get("/healthz", h.health.Liveness())
+	r.Get("/readyz", h.health.Readiness())
+
+	// публичные ключи подписи токенов для других внутренних сервисов
+	r.Get("/.well-known/jwks.json", h.jwks())
 
 	r.Route("/api/user", func(r chi.Router) {
 
-		// Вложенный маршрут с промежуточным обработчиком WithMakeAuth для /register и /login
+		// Вложенный маршрут с промежуточным обработчиком WithMakeAuth для /register, /login и /token/refresh
 		r.Route("/", func(r chi.Router) {
-			r.Use(middleware.WithMakeAuth(h.signatureKey))
+			r.Use(middleware.WithMakeAuth(h.keyring, h.accessTokenTTL))
 
 			r.Post("/register", h.register())
 			r.Post("/login", h.login())
+			r.Post("/login/2fa", h.loginSecondFactor())
+			r.Post("/token/refresh", h.refreshToken())
+		})
+
+		// Смена пароля - только из сессии. WithMakeAuth выдает новую куку взамен отозванной
+		r.Route("/password", func(r chi.Router) {
+			r.With(
+				middleware.WithCheckAuth(h.keyring, h.gmService),
+				middleware.RequireSession,
+				middleware.WithMakeAuth(h.keyring, h.accessTokenTTL),
+			).Post("/", h.changePassword())
+
+			// сброс по токену из нотификатора, юзер не авторизован
+			r.Post("/reset", h.resetPassword())
 		})
 
+		// logout без middleware: кука с access-токеном может уже протухнуть, а выставлять новую не нужно
+		r.Post("/logout", h.logout())
+
 		// Вложенный маршрут для /orders с промежуточным обработчиком CheckAuth
 		r.Route("/orders", func(r chi.Router) {
-			r.Use(middleware.WithCheckAuth(h.signatureKey))
+			r.Use(middleware.WithCheckAuth(h.keyring, h.gmService))
 
-			r.Post("/", h.addOrder())
-			r.Get("/", h.getOrders())
+			r.With(middleware.RequireScope(model.ScopeOrdersWrite)).Post("/", h.addOrder())
+			r.With(middleware.RequireScope(model.ScopeOrdersRead)).Get("/", h.getOrders())
+			r.With(middleware.RequireScope(model.ScopeOrdersRead)).Get("/{number}", h.getOrder())
 		})
 
 		// Вложенный маршрут для /balance с промежуточным обработчиком CheckAuth
 		r.Route("/balance", func(r chi.Router) {
-			r.Use(middleware.WithCheckAuth(h.signatureKey))
+			r.Use(middleware.WithCheckAuth(h.keyring, h.gmService))
 
-			r.Get("/", h.getBalance())
-			r.Post("/withdraw", h.withdraw())
+			r.With(middleware.RequireScope(model.ScopeBalanceRead)).Get("/", h.getBalance())
+			r.With(middleware.RequireScope(model.ScopeBalanceRead)).Get("/history", h.getBalanceHistory())
+			r.With(middleware.RequireScope(model.ScopeBalanceWrite)).Post("/withdraw", h.withdraw())
 		})
 
 		// Вложенный маршрут для /withdrawals с промежуточным обработчиком CheckAuth
 		r.Route("/withdrawals", func(r chi.Router) {
-			r.Use(middleware.WithCheckAuth(h.signatureKey))
+			r.Use(middleware.WithCheckAuth(h.keyring, h.gmService))
+
+			r.With(middleware.RequireScope(model.ScopeWithdrawalsRead)).Get("/", h.getWithdrawals())
+		})
 
-			r.Get("/", h.getWithdrawals())
+		// Управление API-ключами - только из сессии, ключом нельзя выпустить новый ключ
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(middleware.WithCheckAuth(h.keyring, h.gmService), middleware.RequireSession)
+
+			r.Post("/", h.createAPIKey())
+			r.Get("/", h.getAPIKeys())
+			r.Delete("/{id}", h.revokeAPIKey())
+		})
+
+		// Подключение и настройки 2FA - тоже только из сессии
+		r.Route("/2fa", func(r chi.Router) {
+			r.Use(middleware.WithCheckAuth(h.keyring, h.gmService), middleware.RequireSession)
+
+			r.Post("/setup", h.setupTOTP())
+			r.Post("/confirm", h.confirmTOTP())
+			r.Post("/recovery-codes", h.regenerateRecoveryCodes())
+			r.Put("/withdraw-step-up", h.setWithdrawStepUp())
 		})
 
 	})
 
+	// Админка: support и admin смотрят данные любых юзеров и корректируют их баланс, менять роли может только admin.
+	// Только из сессии - у API-ключей нет роли
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(
+			middleware.WithCheckAuth(h.keyring, h.gmService),
+			middleware.RequireSession,
+			middleware.RequireRole(model.RoleSupport, model.RoleAdmin),
+		)
+
+		r.Get("/users", h.findUser())
+		r.Get("/orders/dead-letter", h.getDeadLetterOrders())
+		r.Post("/orders/{number}/requeue", h.requeueOrder())
+		r.Get("/accrual/breaker", h.getAccrualBreaker())
+
+		r.Route("/workers", func(r chi.Router) {
+			r.Use(h.requireWorkerPool)
+
+			r.Get("/", h.getWorkerPool())
+			r.With(middleware.RequireRole(model.RoleAdmin)).Post("/pause", h.pauseWorkerPool())
+			r.With(middleware.RequireRole(model.RoleAdmin)).Post("/resume", h.resumeWorkerPool())
+			r.With(middleware.RequireRole(model.RoleAdmin)).Put("/size", h.resizeWorkerPool())
+		})
+
+		r.Route("/users/{id}", func(r chi.Router) {
+			r.Use(h.adminTargetUser)
+
+			r.Get("/", h.getUser())
+			r.Get("/orders", h.getOrders())
+			r.Get("/orders/{number}", h.getOrder())
+			r.Get("/balance", h.getBalance())
+			r.Get("/balance/history", h.getBalanceHistory())
+			r.Get("/withdrawals", h.getWithdrawals())
+			r.Get("/balance/adjustments", h.getBalanceAdjustments())
+			r.Post("/balance/adjustments", h.adjustBalance())
+			r.With(middleware.RequireRole(model.RoleAdmin)).Put("/role", h.setUserRole())
+		})
+	})
+
 	return r
 }
+
+var errNoUserInContext = errors.New("no user_id in context")
+
+// userIDFromContext достает юзера, которого положил в контекст WithCheckAuth
+func userIDFromContext(r *http.Request) (int64, error) {
+	userID, ok := r.Context().Value(model.UserIDKey).(model.ContextKey)
+	if !ok {
+		return 0, errNoUserInContext
+	}
+
+	return strconv.ParseInt(string(userID), 10, 64)
+}
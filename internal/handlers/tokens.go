@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gophermart/internal/logger"
+	"gophermart/internal/middleware"
+	"gophermart/internal/model"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+func (h *GmHandler) refreshToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		refreshToken := middleware.RefreshTokenFromRequest(r)
+		if refreshToken == "" {
+			logger.Log.Info("refreshToken no refresh token in request")
+			http.Error(w, "no refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		userID, newRefreshToken, err := h.gmService.RefreshToken(ctx, refreshToken)
+		if err != nil {
+			if errors.Is(err, model.ErrRefreshTokenReused) {
+				logger.Log.Warn("refreshToken reuse detected, token family revoked", zap.String("error", err.Error()))
+				middleware.ClearAuthCookies(w)
+				http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+				return
+			} else if errors.Is(err, model.ErrInvalidRefreshToken) {
+				logger.Log.Info("refreshToken invalid token", zap.String("error", err.Error()))
+				middleware.ClearAuthCookies(w)
+				http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+				return
+			} else {
+				logger.Log.Error("refreshToken RefreshToken error", zap.String("error", err.Error()))
+				http.Error(w, "refreshToken error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// роль могла поменяться с прошлого токена
+		role, err := h.gmService.GetUserRole(ctx, userID)
+		if err != nil {
+			logger.Log.Error("refreshToken GetUserRole error", zap.String("error", err.Error()))
+			http.Error(w, "refreshToken error", http.StatusInternalServerError)
+			return
+		}
+
+		middleware.SetRefreshCookie(w, newRefreshToken, h.refreshTokenTTL)
+
+		// закидываем юзера в хедеры чтоб потом навесить куку с новым access-токеном
+		w.Header().Set(string(model.UserIDKey), strconv.FormatInt(userID, 10))
+		w.Header().Set(string(model.UserRoleKey), role)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *GmHandler) logout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if refreshToken := middleware.RefreshTokenFromRequest(r); refreshToken != "" {
+			if err := h.gmService.Logout(ctx, refreshToken); err != nil {
+				logger.Log.Error("logout Logout error", zap.String("error", err.Error()))
+				http.Error(w, "logout error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		middleware.ClearAuthCookies(w)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *GmHandler) jwks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := json.Marshal(h.keyring.JWKS())
+		if err != nil {
+			logger.Log.Error("jwks marshal response error", zap.String("error", err.Error()))
+			http.Error(w, "jwks marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
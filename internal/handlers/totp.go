@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+func (h *GmHandler) setupTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("setupTOTP get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "setupTOTP get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		setup, err := h.gmService.SetupTOTP(ctx, userID)
+		if err != nil {
+			if errors.Is(err, model.ErrTOTPAlreadyEnabled) {
+				logger.Log.Info("setupTOTP SetupTOTP error", zap.String("error", err.Error()))
+				http.Error(w, "2fa is already enabled", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, model.ErrSecretEncrypterNotDefined) {
+				logger.Log.Warn("setupTOTP SetupTOTP error", zap.String("error", err.Error()))
+				http.Error(w, "2fa is not configured on this server", http.StatusNotImplemented)
+				return
+			}
+			logger.Log.Error("setupTOTP SetupTOTP error", zap.String("error", err.Error()))
+			http.Error(w, "setupTOTP error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := json.Marshal(setup)
+		if err != nil {
+			http.Error(w, "setupTOTP marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+func (h *GmHandler) confirmTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("confirmTOTP get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "confirmTOTP get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("confirmTOTP reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "confirmTOTP reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.TOTPCodeRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("confirmTOTP unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "confirmTOTP unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := h.gmService.ConfirmTOTP(ctx, userID, req.Code)
+		if err != nil {
+			if errors.Is(err, model.ErrTOTPAlreadyEnabled) {
+				logger.Log.Info("confirmTOTP ConfirmTOTP error", zap.String("error", err.Error()))
+				http.Error(w, "2fa is already enabled", http.StatusConflict)
+				return
+			} else if errors.Is(err, model.ErrTOTPSetupNotFound) {
+				logger.Log.Info("confirmTOTP ConfirmTOTP error", zap.String("error", err.Error()))
+				http.Error(w, "2fa setup not started", http.StatusConflict)
+				return
+			} else if !secondFactorError(w, err, "confirmTOTP") {
+				logger.Log.Error("confirmTOTP ConfirmTOTP error", zap.String("error", err.Error()))
+				http.Error(w, "confirmTOTP error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp, err := json.Marshal(codes)
+		if err != nil {
+			http.Error(w, "confirmTOTP marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+func (h *GmHandler) regenerateRecoveryCodes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("regenerateRecoveryCodes get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "regenerateRecoveryCodes get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("regenerateRecoveryCodes reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "regenerateRecoveryCodes reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.TOTPCodeRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("regenerateRecoveryCodes unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "regenerateRecoveryCodes unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := h.gmService.RegenerateRecoveryCodes(ctx, userID, req.Code)
+		if err != nil {
+			if !secondFactorError(w, err, "regenerateRecoveryCodes") {
+				logger.Log.Error("regenerateRecoveryCodes RegenerateRecoveryCodes error", zap.String("error", err.Error()))
+				http.Error(w, "regenerateRecoveryCodes error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp, err := json.Marshal(codes)
+		if err != nil {
+			http.Error(w, "regenerateRecoveryCodes marshal response error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
+func (h *GmHandler) setWithdrawStepUp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := userIDFromContext(r)
+		if err != nil {
+			logger.Log.Error("setWithdrawStepUp get user_id from context error", zap.String("error", err.Error()))
+			http.Error(w, "setWithdrawStepUp get user_id from context error", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("setWithdrawStepUp reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "setWithdrawStepUp reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.WithdrawStepUpRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("setWithdrawStepUp unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "setWithdrawStepUp unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		err = h.gmService.SetWithdrawStepUp(ctx, userID, req.Required, req.Code)
+		if err != nil {
+			if !secondFactorError(w, err, "setWithdrawStepUp") {
+				logger.Log.Error("setWithdrawStepUp SetWithdrawStepUp error", zap.String("error", err.Error()))
+				http.Error(w, "setWithdrawStepUp error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// loginSecondFactor - второй шаг логина: токен из ответа /login и код из аутентификатора или код восстановления
+func (h *GmHandler) loginSecondFactor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error("loginSecondFactor reading request body error", zap.String("error", err.Error()))
+			http.Error(w, "loginSecondFactor reading request body error", http.StatusInternalServerError)
+			return
+		}
+
+		var req model.SecondFactorRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			logger.Log.Error("loginSecondFactor unmarshal body error", zap.String("error", err.Error()))
+			http.Error(w, "loginSecondFactor unmarshal body error", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := h.gmService.CompleteSecondFactor(ctx, req.Token, req.Code)
+		if err != nil {
+			if errors.Is(err, model.ErrInvalidLoginChallenge) {
+				logger.Log.Info("loginSecondFactor CompleteSecondFactor error", zap.String("error", err.Error()))
+				http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+				return
+			} else if errors.Is(err, model.ErrWrongTOTPCode) {
+				logger.Log.Info("loginSecondFactor CompleteSecondFactor error", zap.String("error", err.Error()))
+				http.Error(w, "wrong 2fa code", http.StatusUnauthorized)
+				return
+			} else if !secondFactorError(w, err, "loginSecondFactor") {
+				logger.Log.Error("loginSecondFactor CompleteSecondFactor error", zap.String("error", err.Error()))
+				http.Error(w, "loginSecondFactor error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		h.completeLogin(w, r, userID)
+	}
+}
+
+// secondFactorError отвечает на ошибки проверки кода второго фактора. false - ошибка не про второй фактор
+func secondFactorError(w http.ResponseWriter, err error, handlerName string) bool {
+	var lockedErr model.LoginLockedError
+
+	switch {
+	case errors.As(err, &lockedErr):
+		logger.Log.Warn(handlerName+" second factor locked", zap.String("error", err.Error()))
+		writeLoginLocked(w, lockedErr)
+	case errors.Is(err, model.ErrSecondFactorRequired):
+		logger.Log.Info(handlerName+" second factor required", zap.String("error", err.Error()))
+		http.Error(w, "second factor required", http.StatusForbidden)
+	case errors.Is(err, model.ErrWrongTOTPCode):
+		logger.Log.Info(handlerName+" wrong second factor code", zap.String("error", err.Error()))
+		http.Error(w, "wrong 2fa code", http.StatusForbidden)
+	case errors.Is(err, model.ErrTOTPNotEnabled):
+		logger.Log.Info(handlerName+" 2fa is not enabled", zap.String("error", err.Error()))
+		http.Error(w, "2fa is not enabled", http.StatusConflict)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// writeLoginLocked отвечает 429 с Retry-After в секундах
+func writeLoginLocked(w http.ResponseWriter, lockedErr model.LoginLockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+	http.Error(w, "too many login attempts", http.StatusTooManyRequests)
+}
@@ -0,0 +1,138 @@
+// Package health - пробы для оркестратора: /healthz (процесс жив) и /readyz (зависимости в порядке, можно слать трафик).
+// При остановке сервиса readiness начинает отвечать 503, чтобы балансировщик успел увести трафик до выхода процесса
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+
+	DefaultCheckTimeout = 2 * time.Second
+)
+
+// CheckFunc проверяет одну зависимость, nil - все в порядке
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// CheckResult - результат одной проверки в ответе /readyz
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report - тело ответа /healthz и /readyz
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Health struct {
+	checks       []check
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Health{timeout: timeout}
+}
+
+// Add регистрирует проверку для readiness. Вызывается до старта сервера
+func (h *Health) Add(name string, fn CheckFunc) {
+	h.checks = append(h.checks, check{name: name, fn: fn})
+}
+
+// SetShuttingDown переводит readiness в 503, liveness при этом остается 200
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Check выполняет все проверки параллельно, каждую со своим таймаутом
+func (h *Health) Check(ctx context.Context) Report {
+	if h.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.fn(ctx)
+			result := CheckResult{Status: StatusOK, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Liveness - /healthz. Зависимости не проверяет: перезапуск процесса не вылечит упавшую базу
+func (h *Health) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusOK})
+	}
+}
+
+// Readiness - /readyz с результатом каждой проверки
+func (h *Health) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		writeReport(w, code, report)
+	}
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	resp, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "marshal health report error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(resp)
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"gophermart/internal/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// poolCollector снимает pgxpool.Stat на каждый scrape
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		pool:                 pool,
+		acquiredConns:        desc("acquired_conns", "Соединения, занятые запросами."),
+		idleConns:            desc("idle_conns", "Свободные соединения."),
+		constructingConns:    desc("constructing_conns", "Соединения, которые сейчас устанавливаются."),
+		totalConns:           desc("total_conns", "Все соединения пула."),
+		maxConns:             desc("max_conns", "Максимальный размер пула."),
+		acquireCount:         desc("acquire_total", "Сколько раз соединение брали из пула."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Суммарное время ожидания соединения из пула."),
+		emptyAcquireCount:    desc("empty_acquire_total", "Сколько раз пришлось ждать, потому что свободных соединений не было."),
+		canceledAcquireCount: desc("canceled_acquire_total", "Сколько раз ожидание соединения отменили через контекст."),
+		newConnsCount:        desc("new_conns_total", "Сколько соединений было открыто."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquireCount
+	ch <- c.newConnsCount
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConnsCount, prometheus.CounterValue, float64(stat.NewConnsCount()))
+}
+
+// QueueSource считает заказы, ожидающие расчета начислений, по статусам
+type QueueSource interface {
+	CountOrdersByStatus(ctx context.Context, statuses []string) (map[string]int64, error)
+}
+
+// queueCollector отдает глубину очереди воркера accrual. Считается запросом в базу на каждый scrape
+type queueCollector struct {
+	src      QueueSource
+	statuses []string
+	depth    *prometheus.Desc
+}
+
+func NewQueueCollector(src QueueSource, statuses []string) prometheus.Collector {
+	return &queueCollector{
+		src:      src,
+		statuses: statuses,
+		depth: prometheus.NewDesc(prometheus.BuildFQName(namespace, "orders", "queue_depth"),
+			"Заказы, которые ждут расчета начислений, по статусам.", []string{"status"}, nil),
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.src.CountOrdersByStatus(context.Background(), c.statuses)
+	if err != nil {
+		logger.Log.Error("queueCollector CountOrdersByStatus error", zap.String("error", err.Error()))
+		ch <- prometheus.NewInvalidMetric(c.depth, err)
+		return
+	}
+
+	for _, status := range c.statuses {
+		ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(counts[status]), status)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type queueSourceFunc func(ctx context.Context, statuses []string) (map[string]int64, error)
+
+func (f queueSourceFunc) CountOrdersByStatus(ctx context.Context, statuses []string) (map[string]int64, error) {
+	return f(ctx, statuses)
+}
+
+func TestQueueCollector(t *testing.T) {
+	statuses := []string{"NEW", "PROCESSING", "REGISTERED"}
+
+	t.Run("missing statuses are zero", func(t *testing.T) {
+		c := NewQueueCollector(queueSourceFunc(func(_ context.Context, got []string) (map[string]int64, error) {
+			assert.Equal(t, statuses, got)
+			return map[string]int64{"NEW": 3, "REGISTERED": 1}, nil
+		}), statuses)
+
+		expected := `
+# HELP gophermart_orders_queue_depth Заказы, которые ждут расчета начислений, по статусам.
+# TYPE gophermart_orders_queue_depth gauge
+gophermart_orders_queue_depth{status="NEW"} 3
+gophermart_orders_queue_depth{status="PROCESSING"} 0
+gophermart_orders_queue_depth{status="REGISTERED"} 1
+`
+		require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	})
+
+	t.Run("db error fails the scrape", func(t *testing.T) {
+		c := NewQueueCollector(queueSourceFunc(func(context.Context, []string) (map[string]int64, error) {
+			return nil, errors.New("db is down")
+		}), statuses)
+
+		_, err := testutil.CollectAndLint(c)
+		assert.Error(t, err)
+	})
+}
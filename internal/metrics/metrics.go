@@ -0,0 +1,121 @@
+// Package metrics - метрики Prometheus для /metrics: HTTP, пул соединений с базой, клиент accrual и очередь заказов
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophermart"
+
+// Registry - собственный реестр, чтобы в /metrics не попадало то, что регистрируют чужие пакеты в default
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Количество HTTP-запросов по шаблону маршрута chi, методу и коду ответа.",
+	}, []string{"method", "route", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки HTTP-запроса по шаблону маршрута chi и методу.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	AccrualRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "requests_total",
+		Help:      "Запросы в систему расчета начислений по коду ответа, error - ответа не было.",
+	}, []string{"code"})
+
+	AccrualDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "request_duration_seconds",
+		Help:      "Время ответа системы расчета начислений.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	AccrualBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "circuit_breaker_state",
+		Help:      "Состояние circuit breaker клиента accrual: 0 - closed, 1 - open, 2 - half-open.",
+	})
+
+	AccrualWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "workers",
+		Help:      "Запущенные воркеры accrual.",
+	})
+
+	OrdersDeadLettered = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "dead_lettered_total",
+		Help:      "Заказы, отправленные в dead letter после исчерпания попыток.",
+	})
+
+	BalanceDrift = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balance",
+		Name:      "ledger_drift_total",
+		Help:      "Проверки баланса, на которых user_balance разошелся с журналом.",
+	})
+
+	OrderTimeToFinal = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "time_to_final_status_seconds",
+		Help:      "Время от загрузки заказа до финального статуса PROCESSED или INVALID.",
+		// от секунды до ~9 часов
+		Buckets: prometheus.ExponentialBuckets(1, 3, 10),
+	}, []string{"status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		AccrualRequests,
+		AccrualDuration,
+		AccrualBreakerState,
+		AccrualWorkers,
+		OrdersDeadLettered,
+		BalanceDrift,
+		OrderTimeToFinal,
+	)
+}
+
+// Register добавляет в реестр коллекторы, которым нужны зависимости: пул соединений, репозиторий
+func Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := Registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler отдает метрики в формате Prometheus. Сжатие выключено - ответы и так жмет WithGzip
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{DisableCompression: true})
+}
+
+// ObserveOrderFinal записывает, сколько заказ шел от загрузки до финального статуса
+func ObserveOrderFinal(status string, uploadedAt time.Time) {
+	OrderTimeToFinal.WithLabelValues(status).Observe(time.Since(uploadedAt).Seconds())
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator проверяет API-ключ и возвращает его владельца и scope
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (int64, []string, error)
+}
+
+// SessionValidator сообщает, с какого момента принимаются access-токены юзера.
+// Токены, выпущенные раньше (например, до смены пароля), считаются отозванными
+type SessionValidator interface {
+	TokensValidAfter(ctx context.Context, userID int64) (time.Time, error)
+}
+
+// Authenticator - все, что нужно WithCheckAuth помимо подписи токена
+type Authenticator interface {
+	APIKeyAuthenticator
+	SessionValidator
+}
+
+// credentialsFromHeaders достает API-ключ или JWT из заголовков запроса
+func credentialsFromHeaders(r *http.Request) (apiKey, bearer string) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key, ""
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", ""
+	}
+
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, model.APIKeyPrefix) {
+		return token, ""
+	}
+
+	return "", token
+}
+
+func checkAPIKey(h http.Handler, w http.ResponseWriter, r *http.Request, apiKeys APIKeyAuthenticator, apiKey string) {
+	userID, scopes, err := apiKeys.AuthenticateAPIKey(r.Context(), apiKey)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidAPIKey) {
+			logger.Log.Info("WithCheckAuth middleware. invalid api key")
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		logger.Log.Error("WithCheckAuth middleware. AuthenticateAPIKey error", zap.String("error", err.Error()))
+		http.Error(w, "check api key error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), model.UserIDKey, model.ContextKey(strconv.FormatInt(userID, 10)))
+	ctx = context.WithValue(ctx, model.AuthScopesKey, scopes)
+
+	h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func checkBearer(h http.Handler, w http.ResponseWriter, r *http.Request, keyring *Keyring, sessions SessionValidator, token string) {
+	userID, role, err := authenticateToken(r.Context(), keyring, sessions, token)
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			logger.Log.Info("WithCheckAuth middleware. invalid bearer token", zap.Error(err))
+			http.Error(w, "invalid auth token", http.StatusUnauthorized)
+			return
+		}
+		logger.Log.Error("WithCheckAuth middleware. check bearer token error", zap.String("error", err.Error()))
+		http.Error(w, "check auth token error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), model.UserIDKey, model.ContextKey(userID))
+	ctx = context.WithValue(ctx, model.UserRoleKey, role)
+
+	h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+var errInvalidToken = errors.New("invalid auth token")
+
+// authenticateToken проверяет подпись и срок access-токена, а также что он не отозван сменой пароля или роли.
+// Возвращает юзера и его роль. Ошибки, за которые отвечает клиент, оборачивают errInvalidToken
+func authenticateToken(ctx context.Context, keyring *Keyring, sessions SessionValidator, token string) (string, string, error) {
+	c, err := parseAuthToken(keyring, token)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+
+	if c.UserID == "" {
+		return "", "", fmt.Errorf("%w: absent user_id", errInvalidToken)
+	}
+
+	userID, err := strconv.ParseInt(c.UserID, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+
+	validAfter, err := sessions.TokensValidAfter(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrTokenRevoked) {
+			return "", "", fmt.Errorf("%w: %w", errInvalidToken, err)
+		}
+		return "", "", err
+	}
+
+	// iat хранится с точностью до секунды
+	if !validAfter.IsZero() && (c.IssuedAt == nil || c.IssuedAt.Time.Before(validAfter.Truncate(time.Second))) {
+		return "", "", fmt.Errorf("%w: %w", errInvalidToken, model.ErrTokenRevoked)
+	}
+
+	role := c.Role
+	if role == "" {
+		role = model.RoleUser
+	}
+
+	return c.UserID, role, nil
+}
+
+// RequireScope - middleware, который пускает запрос по API-ключу, только если у ключа есть scope.
+// Запросы с сессионным токеном проходят всегда.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isAPIKey := r.Context().Value(model.AuthScopesKey).([]string)
+			if isAPIKey && !slices.Contains(scopes, scope) {
+				logger.Log.Info("RequireScope middleware. scope is missing", zap.String("scope", scope))
+				http.Error(w, "api key has no scope "+scope, http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession - middleware, который не пускает запросы по API-ключу, например к управлению самими ключами
+func RequireSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isAPIKey := r.Context().Value(model.AuthScopesKey).([]string); isAPIKey {
+			logger.Log.Info("RequireSession middleware. api key is not allowed")
+			http.Error(w, "api key is not allowed here", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole - middleware, который пускает только юзеров с одной из ролей.
+// Роль берется из токена сессии, у запросов по API-ключу роли нет - они не проходят
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(model.UserRoleKey).(string)
+			if !slices.Contains(roles, role) {
+				logger.Log.Info("RequireRole middleware. role is not allowed", zap.String("role", role), zap.Strings("roles", roles))
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
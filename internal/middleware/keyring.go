@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// LegacyKeyID - kid ключа из SIGNATURE_KEY. Им же проверяются токены, выпущенные до появления kid
+const LegacyKeyID = "default"
+
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+// SigningKey - ключ подписи токенов. У ключа только для проверки signKey пустой
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey создает симметричный ключ HS256
+func NewHMACKey(kid string, secret []byte) SigningKey {
+	return SigningKey{ID: kid, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewEdDSAKey создает ключ EdDSA. Если private == nil, ключ годится только для проверки
+func NewEdDSAKey(kid string, private ed25519.PrivateKey, public ed25519.PublicKey) SigningKey {
+	key := SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+		key.verifyKey = private.Public()
+	}
+	return key
+}
+
+// NewRSAKey создает ключ RS256. Если private == nil, ключ годится только для проверки
+func NewRSAKey(kid string, private *rsa.PrivateKey, public *rsa.PublicKey) SigningKey {
+	key := SigningKey{ID: kid, Method: jwt.SigningMethodRS256, verifyKey: public}
+	if private != nil {
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	}
+	return key
+}
+
+// Keyring - набор ключей для проверки токенов и текущий ключ для подписи новых.
+// Ротация: добавляем новый ключ, делаем его текущим, а старый удаляем, когда выпущенные им токены протухнут.
+type Keyring struct {
+	current string
+	keys    map[string]SigningKey
+}
+
+func NewKeyring(currentKID string, keys ...SigningKey) (*Keyring, error) {
+	k := &Keyring{current: currentKID, keys: make(map[string]SigningKey, len(keys))}
+
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("NewKeyring: signing key without id")
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("NewKeyring: duplicate key id %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	current, ok := k.keys[currentKID]
+	if !ok {
+		return nil, fmt.Errorf("NewKeyring: current key %q: %w", currentKID, ErrUnknownKeyID)
+	}
+	if current.signKey == nil {
+		return nil, fmt.Errorf("NewKeyring: current key %q has no private part", currentKID)
+	}
+
+	return k, nil
+}
+
+// LoadKeyring собирает keyring из конфига.
+// spec - список ключей через запятую в формате kid:alg:source, где для HS256 source - сам секрет,
+// а для EdDSA и RS256 - путь к PEM файлу с приватным (или только публичным) ключом.
+// legacySecret, если задан, добавляется как HS256 ключ с kid LegacyKeyID.
+func LoadKeyring(spec, currentKID, legacySecret string) (*Keyring, error) {
+	var keys []SigningKey
+	if legacySecret != "" {
+		keys = append(keys, NewHMACKey(LegacyKeyID, []byte(legacySecret)))
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("LoadKeyring: invalid key spec %q, want kid:alg:source", entry)
+		}
+
+		key, err := loadKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeyring: key %q: %w", parts[0], err)
+		}
+		keys = append(keys, key)
+	}
+
+	if currentKID == "" {
+		currentKID = LegacyKeyID
+	}
+
+	return NewKeyring(currentKID, keys...)
+}
+
+func loadKey(kid, alg, source string) (SigningKey, error) {
+	if alg == jwt.SigningMethodHS256.Alg() {
+		return NewHMACKey(kid, []byte(source)), nil
+	}
+
+	pemBytes, err := os.ReadFile(source)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	switch alg {
+	case jwt.SigningMethodEdDSA.Alg():
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+			return NewEdDSAKey(kid, private.(ed25519.PrivateKey), nil), nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		return NewEdDSAKey(kid, nil, public.(ed25519.PublicKey)), nil
+	case jwt.SigningMethodRS256.Alg():
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+			return NewRSAKey(kid, private, nil), nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		return NewRSAKey(kid, nil, public), nil
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid в заголовок
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.keys[k.current]
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signKey)
+}
+
+// keyFunc выбирает ключ проверки по kid и не дает подменить алгоритм
+func (k *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWK - публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные ключи для проверки токенов другими сервисами. Симметричные ключи не публикуются
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range k.keys {
+		var public crypto.PublicKey = key.verifyKey
+
+		switch pk := public.(type) {
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pk),
+			})
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pk.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := NewHMACKey("2024-01", []byte("old_secret"))
+	newKey := NewHMACKey("2024-06", []byte("new_secret"))
+
+	before, err := NewKeyring("2024-01", oldKey)
+	require.NoError(t, err)
+	after, err := NewKeyring("2024-06", oldKey, newKey)
+	require.NoError(t, err)
+	retired, err := NewKeyring("2024-06", newKey)
+	require.NoError(t, err)
+
+	oldToken, err := MakeAuthToken(before, "42", "", time.Minute)
+	require.NoError(t, err)
+	newToken, err := MakeAuthToken(after, "43", "", time.Minute)
+	require.NoError(t, err)
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", parsed.Header["kid"])
+
+	userID, err := getUserID(after, oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "42", userID)
+
+	userID, err = getUserID(after, newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "43", userID)
+
+	_, err = getUserID(retired, oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	_, err = getUserID(before, newToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestKeyringLegacyToken(t *testing.T) {
+	// токен без kid, выпущенный до появления keyring
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		UserID:           "7",
+	}).SignedString([]byte("super_secret"))
+	require.NoError(t, err)
+
+	keyring, err := LoadKeyring("", "", "super_secret")
+	require.NoError(t, err)
+
+	userID, err := getUserID(keyring, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "7", userID)
+}
+
+func TestKeyringEdDSA(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "ed25519.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keyring, err := LoadKeyring("ed1:EdDSA:"+keyPath, "ed1", "super_secret")
+	require.NoError(t, err)
+
+	token, err := MakeAuthToken(keyring, "5", "", time.Minute)
+	require.NoError(t, err)
+
+	userID, err := getUserID(keyring, token)
+	require.NoError(t, err)
+	assert.Equal(t, "5", userID)
+
+	jwks := keyring.JWKS()
+	require.Len(t, jwks.Keys, 1, "symmetric keys must not be published")
+	assert.Equal(t, "ed1", jwks.Keys[0].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{UserID: "1"})
+		forged.Header["kid"] = "ed1"
+		forgedString, err := forged.SignedString([]byte(private.Public().(ed25519.PublicKey)))
+		require.NoError(t, err)
+
+		_, err = getUserID(keyring, forgedString)
+		assert.Error(t, err)
+	})
+}
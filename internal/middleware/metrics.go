@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"gophermart/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// unmatchedRoute - метка для запросов, которые не попали ни в один маршрут, чтобы сканеры не плодили серии
+const unmatchedRoute = "unmatched"
+
+// WithMetrics - middleware, считающее запросы и время ответа по шаблону маршрута chi (/api/admin/users/{id}/orders),
+// а не по пути, чтобы число серий не зависело от id в URL. Должно стоять на корневом роутере
+func WithMetrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		responseData := &responseData{}
+		lw := loggingResponseWriter{
+			ResponseWriter: w,
+			responseData:   responseData,
+		}
+
+		h.ServeHTTP(&lw, r)
+
+		// шаблон известен только после роутинга
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := responseData.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
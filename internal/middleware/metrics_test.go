@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"gophermart/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMetricsRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(WithMetrics)
+	r.Route("/api/admin/users/{id}", func(r chi.Router) {
+		r.Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	for _, path := range []string{"/api/admin/users/1/orders", "/api/admin/users/2/orders", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/api/admin/users/{id}/orders", "204")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")))
+}
@@ -93,12 +93,22 @@ func WithGzip(h http.Handler) http.Handler {
 	})
 }
 
-// WithCheckAuth - middleware который чекает авторизацию
-func WithCheckAuth(key string) func(http.Handler) http.Handler {
+// WithCheckAuth - middleware который чекает авторизацию.
+// Юзер определяется по API-ключу (X-API-Key или Authorization: Bearer gm_...), по JWT из Authorization: Bearer
+// или по JWT из куки authToken - именно в таком порядке.
+func WithCheckAuth(keyring *Keyring, auth Authenticator) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger.Log.Info("WithCheckAuth middleware")
 
+			if apiKey, bearer := credentialsFromHeaders(r); apiKey != "" {
+				checkAPIKey(h, w, r, auth, apiKey)
+				return
+			} else if bearer != "" {
+				checkBearer(h, w, r, keyring, auth, bearer)
+				return
+			}
+
 			tokenWithUser, err := r.Cookie(cookieName)
 			if tokenWithUser != nil {
 				logger.Log.Info("WithAuth middleware. tokenWithUser != nil", zap.String(" tokenWithUser.Value", tokenWithUser.Value))
@@ -119,13 +129,19 @@ func WithCheckAuth(key string) func(http.Handler) http.Handler {
 				return
 			}
 
-			var userID string
+			var userID, role string
 			if tokenWithUser.Value != "" {
 				logger.Log.Info("WithAuth middleware. tokenWithUser.Value != ''", zap.String(" tokenWithUser.Value: ", tokenWithUser.Value))
-				userID, err = getUserID(key, tokenWithUser.Value)
+				userID, role, err = authenticateToken(r.Context(), keyring, auth, tokenWithUser.Value)
 				logger.Log.Info("WithAuth middleware. token.GetUserID", zap.String("userID: ", userID))
 				if err != nil {
-					http.Error(w, "Get userID from token error", http.StatusInternalServerError)
+					if errors.Is(err, errInvalidToken) {
+						logger.Log.Info("WithAuth middleware. invalid token", zap.String("error", err.Error()))
+						http.Error(w, "invalid auth token", http.StatusUnauthorized)
+						return
+					}
+					logger.Log.Error("WithAuth middleware. check auth token error", zap.String("error", err.Error()))
+					http.Error(w, "check auth token error", http.StatusInternalServerError)
 					return
 				}
 			} else {
@@ -147,6 +163,7 @@ func WithCheckAuth(key string) func(http.Handler) http.Handler {
 
 			userForContext := model.ContextKey(userID)
 			ctx := context.WithValue(r.Context(), model.UserIDKey, userForContext)
+			ctx = context.WithValue(ctx, model.UserRoleKey, role)
 			r = r.WithContext(ctx)
 
 			h.ServeHTTP(&aw, r)
@@ -155,14 +172,15 @@ func WithCheckAuth(key string) func(http.Handler) http.Handler {
 }
 
 // WithMakeAuth - middleware который навешивает куку для авторизации
-func WithMakeAuth(key string) func(http.Handler) http.Handler {
+func WithMakeAuth(keyring *Keyring, tokenTTL time.Duration) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger.Log.Info("WithMakeAuth middleware")
 
 			aw := makeAuthResponseWriter{
 				ResponseWriter: w,
-				signatureKey:   key,
+				keyring:        keyring,
+				tokenTTL:       tokenTTL,
 			}
 
 			h.ServeHTTP(&aw, r)
@@ -12,12 +12,19 @@ import (
 	"go.uber.org/zap"
 )
 
-const cookieName = "authToken"
+const (
+	cookieName        = "authToken"
+	refreshCookieName = "refreshToken"
+	refreshCookiePath = "/api/user"
+
+	DefaultAccessTokenTTL = 15 * time.Minute
+)
 
 type makeAuthResponseWriter struct {
 	http.ResponseWriter
-	signatureKey string
-	authToken    string
+	keyring   *Keyring
+	tokenTTL  time.Duration
+	authToken string
 }
 
 func (r *makeAuthResponseWriter) Write(b []byte) (int, error) {
@@ -25,10 +32,17 @@ func (r *makeAuthResponseWriter) Write(b []byte) (int, error) {
 }
 
 func (r *makeAuthResponseWriter) WriteHeader(statusCode int) {
+	userID := r.Header().Get(string(model.UserIDKey))
+	role := r.Header().Get(string(model.UserRoleKey))
+	// хендлер не авторизовал юзера - куку не ставим
+	if userID == "" {
+		r.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
 	if r.authToken == "" {
 		var err error
-		userID := r.Header().Get(string(model.UserIDKey))
-		r.authToken, err = MakeAuthToken(r.signatureKey, userID)
+		r.authToken, err = MakeAuthToken(r.keyring, userID, role, r.tokenTTL)
 		if err != nil {
 			logger.Log.Error("WithAuth middleware. WriteHeader MakeAuthToken error", zap.String("error: ", err.Error()), zap.String("UserID: ", userID))
 		}
@@ -52,6 +66,12 @@ func (r *checkAuthResponseWriter) Write(b []byte) (int, error) {
 }
 
 func (r *checkAuthResponseWriter) WriteHeader(statusCode int) {
+	// хендлер уже выдал новый токен (например, после смены пароля) - старый обратно не ставим
+	if hasCookie(r.Header(), cookieName) {
+		r.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
 	cookie := http.Cookie{Name: cookieName, Value: r.authToken}
 	http.SetCookie(r.ResponseWriter, &cookie)
 
@@ -63,44 +83,52 @@ func (r *checkAuthResponseWriter) WriteHeader(statusCode int) {
 }
 
 // Claims — структура утверждений, которая включает стандартные утверждения
-// и одно пользовательское — UserID
+// и пользовательские — UserID и роль. В токенах, выпущенных до появления ролей, роли нет - это обычный юзер
 type claims struct {
 	jwt.RegisteredClaims
 	UserID string
+	Role   string `json:"role,omitempty"`
 }
 
-const tokenExp = time.Hour * 3
+func getUserID(keyring *Keyring, tokenString string) (string, error) {
+	claims, err := parseAuthToken(keyring, tokenString)
+	if err != nil {
+		return "", err
+	}
 
-func getUserID(key, tokenString string) (string, error) {
+	return claims.UserID, nil
+}
+
+// parseAuthToken проверяет подпись и срок токена и возвращает его утверждения
+func parseAuthToken(keyring *Keyring, tokenString string) (*claims, error) {
 	claims := &claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(key), nil
-		})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.keyFunc)
 	if err != nil {
-		return "", fmt.Errorf("token-GetUserId-ParseWithClaims-err: %w", err)
+		return nil, fmt.Errorf("token-GetUserId-ParseWithClaims-err: %w", err)
 	}
 
 	if !token.Valid {
-		return "", errors.New("token-GetUserId-TokenIsNotValid")
+		return nil, errors.New("token-GetUserId-TokenIsNotValid")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
-func MakeAuthToken(key, userID string) (string, error) {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+func MakeAuthToken(keyring *Keyring, userID, role string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	// создаём новый токен, подписанный текущим ключом из keyring, с утверждениями — Claims
+	tokenString, err := keyring.Sign(claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+			IssuedAt: jwt.NewNumericDate(now),
+			// когда токен протухнет
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
-		// собственное утверждение
+		// собственные утверждения
 		UserID: userID,
+		Role:   role,
 	})
-
-	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(key))
 	if err != nil {
 		return "", fmt.Errorf("token-MakeAuthToken-signedToken-err: %w", err)
 	}
@@ -108,3 +136,41 @@ func MakeAuthToken(key, userID string) (string, error) {
 	// возвращаем строку токена
 	return tokenString, nil
 }
+
+// SetRefreshCookie отдает клиенту refresh-токен. Кука доступна только для /api/user, чтобы не улетать с каждым запросом
+func SetRefreshCookie(w http.ResponseWriter, refreshToken string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// RefreshTokenFromRequest достает refresh-токен из куки
+func RefreshTokenFromRequest(r *http.Request) string {
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ClearAuthCookies удаляет у клиента access и refresh куки
+func ClearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Value: "", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Value: "", Path: refreshCookiePath, MaxAge: -1, HttpOnly: true})
+}
+
+// hasCookie проверяет, что в ответе уже выставлена кука name
+func hasCookie(header http.Header, name string) bool {
+	resp := http.Response{Header: header}
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,7 @@
 package model
 
 type Accrual struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual"`
+	Order   string `json:"order"`
+	Status  string `json:"status"`
+	Accrual Money  `json:"accrual"`
 }
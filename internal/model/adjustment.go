@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Причины ручной корректировки баланса
+const (
+	AdjustmentReasonAccrualCorrection = "accrual_correction" // система расчета начислила неверно
+	AdjustmentReasonWithdrawalRefund  = "withdrawal_refund"  // возврат списания, например при отмене заказа
+	AdjustmentReasonGoodwill          = "goodwill"           // компенсация юзеру
+	AdjustmentReasonFraud             = "fraud"              // снятие баллов, полученных мошенничеством
+	AdjustmentReasonOther             = "other"              // все остальное, подробности в заметке
+)
+
+var AdjustmentReasons = []string{
+	AdjustmentReasonAccrualCorrection,
+	AdjustmentReasonWithdrawalRefund,
+	AdjustmentReasonGoodwill,
+	AdjustmentReasonFraud,
+	AdjustmentReasonOther,
+}
+
+var (
+	ErrUnknownAdjustmentReason = errors.New("unknown adjustment reason")
+	ErrEmptyAdjustmentNote     = errors.New("empty adjustment note")
+	ErrZeroAdjustment          = errors.New("zero adjustment amount")
+	// ErrSelfAdjustment - сотрудник правит собственный баланс
+	ErrSelfAdjustment = errors.New("staff cannot adjust their own balance")
+)
+
+// BalanceAdjustmentRequest - ручная корректировка: положительная сумма начисляет баллы, отрицательная списывает
+type BalanceAdjustmentRequest struct {
+	Amount Money  `json:"amount"`
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
+
+// BalanceAdjustment - запись аудита о ручной корректировке, ActorID - кто из поддержки ее сделал
+type BalanceAdjustment struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	ActorID   int64     `json:"actor_id" db:"actor_id"`
+	Amount    Money     `json:"amount" db:"amount"`
+	Reason    string    `json:"reason" db:"reason"`
+	Note      string    `json:"note" db:"note"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// UnmarshalJSON разбирает корректировку строго: сумма точнее сотых отклоняется, а не округляется
+func (r *BalanceAdjustmentRequest) UnmarshalJSON(data []byte) error {
+	type adjustmentRequest BalanceAdjustmentRequest
+	req := struct {
+		*adjustmentRequest
+		Amount json.RawMessage `json:"amount"`
+	}{adjustmentRequest: (*adjustmentRequest)(r)}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("BalanceAdjustmentRequest-Unmarshal-err: %w", err)
+	}
+
+	amount, err := parseMoneyExactJSON(req.Amount)
+	if err != nil {
+		return fmt.Errorf("BalanceAdjustmentRequest-parseMoneyExactJSON-err: %w", err)
+	}
+	r.Amount = amount
+
+	return nil
+}
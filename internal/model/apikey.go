@@ -0,0 +1,45 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// AuthScopesKey - ключ контекста со списком scope, если запрос авторизован API-ключом.
+// У запросов с сессионным токеном (кука или Bearer) scope в контексте нет - им доступно все.
+const AuthScopesKey ContextKey = "auth_scopes"
+
+// APIKeyPrefix помогает отличить API-ключ от JWT в заголовке Authorization и найти утекший ключ в логах
+const APIKeyPrefix = "gm_"
+
+// Scope ограничивает, какие ручки доступны по API-ключу
+const (
+	ScopeOrdersRead      = "orders:read"
+	ScopeOrdersWrite     = "orders:write"
+	ScopeBalanceRead     = "balance:read"
+	ScopeBalanceWrite    = "balance:write"
+	ScopeWithdrawalsRead = "withdrawals:read"
+)
+
+var Scopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeBalanceRead, ScopeBalanceWrite, ScopeWithdrawalsRead}
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrUnknownScope   = errors.New("unknown scope")
+)
+
+type APIKey struct {
+	ID         int64      `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	Key        string     `json:"key,omitempty" db:"-"` // сам ключ отдается только один раз, при создании
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
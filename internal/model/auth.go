@@ -1,6 +1,10 @@
 package model
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type ContextKey string
 
@@ -10,8 +14,22 @@ var (
 	ErrLoginAlreadyExist = errors.New("login already exist")
 	ErrWrongLogin        = errors.New("login does not exist")
 	ErrWrongPas          = errors.New("wrong password")
+	ErrLoginLocked       = errors.New("too many login attempts")
 )
 
+// LoginLockedError - вход временно заблокирован после серии неудачных попыток
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLoginLocked, e.RetryAfter)
+}
+
+func (e LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
 type LogoPass struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
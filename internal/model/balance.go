@@ -1,15 +1,40 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type Balance struct {
-	Current   float64 `json:"current" db:"current_balance"`
-	Withdrawn float64 `json:"withdrawn" db:"withdrawn"`
+	Current   Money `json:"current" db:"current_balance"`
+	Withdrawn Money `json:"withdrawn" db:"withdrawn"`
 }
 
 type Withdraw struct {
 	UserID      int64     `json:"user_id,omitempty" db:"user_id"`
 	OrderID     string    `json:"order" db:"order_id"`
-	Sum         float64   `json:"sum" db:"sum"`
+	Sum         Money     `json:"sum" db:"sum"`
 	ProcessedAt time.Time `json:"processed_at" db:"processed_at"`
 }
+
+// UnmarshalJSON разбирает запрос на списание. Сумму вводит юзер, поэтому точнее сотых она не округляется, а отклоняется
+func (w *Withdraw) UnmarshalJSON(data []byte) error {
+	type withdraw Withdraw
+	req := struct {
+		*withdraw
+		Sum json.RawMessage `json:"sum"`
+	}{withdraw: (*withdraw)(w)}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("Withdraw-Unmarshal-err: %w", err)
+	}
+
+	sum, err := parseMoneyExactJSON(req.Sum)
+	if err != nil {
+		return fmt.Errorf("Withdraw-parseMoneyExactJSON-err: %w", err)
+	}
+	w.Sum = sum
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+)
+
+// CircuitBreakerStatus - состояние circuit breaker клиента accrual для админки
+type CircuitBreakerStatus struct {
+	State            string     `json:"state"`
+	Failures         int        `json:"failures"`
+	FailureThreshold int        `json:"failure_threshold"`
+	OpenTimeout      string     `json:"open_timeout"`
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`
+}
@@ -8,4 +8,5 @@ var (
 	ErrAlreadyUploadedByThisUser    = errors.New("order id has already been uploaded by this user")
 	ErrAlreadyUploadedByAnotherUser = errors.New("order id has already been uploaded by another user")
 	ErrNotEnoughMoney               = errors.New("not enough money")
+	ErrOrderLeaseLost               = errors.New("order lease expired and was taken by another worker")
 )
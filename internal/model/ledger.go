@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Виды проводок в журнале баланса
+const (
+	LedgerKindAccrual    = "accrual"    // начисление за заказ
+	LedgerKindWithdrawal = "withdrawal" // списание в счет оплаты заказа
+	LedgerKindReversal   = "reversal"   // сторнирование ранее сделанного начисления
+	LedgerKindAdjustment = "adjustment" // ручная корректировка
+	LedgerKindOpening    = "opening"    // входящий остаток, перенесенный из старого user_balance
+)
+
+// LedgerEntry - проводка по счету юзера. Положительная сумма - приход, отрицательная - расход
+type LedgerEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Amount    Money     `json:"amount" db:"amount"`
+	OrderID   string    `json:"order,omitempty" db:"order_id"`
+	Reason    string    `json:"reason,omitempty" db:"reason"` // только у ручных корректировок
+	Note      string    `json:"note,omitempty" db:"note"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,223 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// moneyScale - количество сотых в одном балле, столько же знаков после запятой у numeric-колонок в базе
+const moneyScale = 100
+
+var (
+	ErrMoneyInvalid  = errors.New("invalid money value")
+	ErrMoneyOverflow = errors.New("money value out of range")
+)
+
+// moneyLiteral - десятичное число в записи JSON: без дробей вида 1/3, hex и кавычек.
+// Показатель степени ограничен, чтобы big.Rat не строил гигантские числа из "1e999999999"
+var moneyLiteral = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d{1,3})?$`)
+
+// Money - точная сумма баллов в сотых долях.
+// В JSON сериализуется числом в том же виде, что и float64 раньше (500.5, 42),
+// в Postgres читается и пишется как numeric.
+type Money int64
+
+// ParseMoney разбирает сумму, введенную юзером: десятичное число в записи JSON ("500.5", "42", "1e2").
+// Суммы точнее сотых не округляются, а отклоняются: молча терять копейки нельзя
+func ParseMoney(s string) (Money, error) {
+	r, err := parseMoneyLiteral(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if !new(big.Rat).Mul(r, big.NewRat(moneyScale, 1)).IsInt() {
+		return 0, fmt.Errorf("%w: more than 2 fractional digits in %q", ErrMoneyInvalid, s)
+	}
+
+	return moneyFromRat(r)
+}
+
+// parseMoneyExactJSON - строгий разбор суммы из тела запроса юзера. Отсутствующее поле и null - ноль, как у UnmarshalJSON
+func parseMoneyExactJSON(data json.RawMessage) (Money, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return 0, nil
+	}
+
+	return ParseMoney(string(data))
+}
+
+func parseMoneyLiteral(s string) (*big.Rat, error) {
+	if !moneyLiteral.MatchString(s) {
+		return nil, fmt.Errorf("%w: %q", ErrMoneyInvalid, s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrMoneyInvalid, s)
+	}
+
+	return r, nil
+}
+
+// MoneyFromMinor создает сумму из сотых долей
+func MoneyFromMinor(minor int64) Money {
+	return Money(minor)
+}
+
+// Minor возвращает сумму в сотых долях
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+func (m Money) Add(other Money) Money {
+	return m + other
+}
+
+func (m Money) Sub(other Money) Money {
+	return m - other
+}
+
+func (m Money) Neg() Money {
+	return -m
+}
+
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m > 0
+}
+
+// Cmp возвращает -1, 0 или 1, если m меньше, равно или больше other
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m < other:
+		return -1
+	case m > other:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// String возвращает сумму без лишних нулей: 500.5, 42, 0.05
+func (m Money) String() string {
+	minor := int64(m)
+
+	sign := ""
+	abs := uint64(minor)
+	if minor < 0 {
+		sign = "-"
+		abs = uint64(-minor)
+	}
+
+	whole := strconv.FormatUint(abs/moneyScale, 10)
+	frac := abs % moneyScale
+	if frac == 0 {
+		return sign + whole
+	}
+
+	return sign + whole + "." + strings.TrimRight(fmt.Sprintf("%02d", frac), "0")
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON принимает только JSON-число, как раньше float64. Знаки точнее сотых округляются от нуля:
+// так читаются ответы accrual, где сумма может прийти с тремя знаками. Суммы от юзера разбираются строго, см. ParseMoney
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+
+	r, err := parseMoneyLiteral(s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := moneyFromRat(r)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric реализует pgtype.NumericScanner
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*m = 0
+		return nil
+	}
+
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: %v", ErrMoneyInvalid, v)
+	}
+
+	r := new(big.Rat).SetInt(v.Int)
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt32(v.Exp))), nil)
+	if v.Exp >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(pow))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+
+	parsed, err := moneyFromRat(r)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// NumericValue реализует pgtype.NumericValuer
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(m)), Exp: -2, Valid: true}, nil
+}
+
+// moneyFromRat округляет до сотых от нуля, так же как при записи в numeric(_, 2)
+func moneyFromRat(r *big.Rat) (Money, error) {
+	r = new(big.Rat).Mul(r, big.NewRat(moneyScale, 1))
+
+	// округление до целого от нуля
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	if !quo.IsInt64() || quo.Int64() == math.MinInt64 {
+		return 0, ErrMoneyOverflow
+	}
+
+	return Money(quo.Int64()), nil
+}
+
+func absInt32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
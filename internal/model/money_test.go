@@ -0,0 +1,149 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Money
+		json  string
+	}{
+		{name: "integer", input: "42", want: 4200, json: "42"},
+		{name: "one decimal", input: "500.5", want: 50050, json: "500.5"},
+		{name: "two decimals", input: "729.98", want: 72998, json: "729.98"},
+		{name: "small", input: "0.05", want: 5, json: "0.05"},
+		{name: "negative", input: "-3.1", want: -310, json: "-3.1"},
+		{name: "exponent", input: "1.5e2", want: 15000, json: "150"},
+		{name: "exponent with fraction", input: "1.234e1", want: 1234, json: "12.34"},
+		{name: "trailing zeros", input: "0.500", want: 50, json: "0.5"},
+		{name: "accrual rounded half away from zero", input: "729.985", want: 72999, json: "729.99"},
+		{name: "negative rounded half away from zero", input: "-0.125", want: -13, json: "-0.13"},
+		{name: "float drift", input: "0.30000000000000004", want: 30, json: "0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			require.NoError(t, json.Unmarshal([]byte(tt.input), &got))
+			assert.Equal(t, tt.want, got)
+
+			out, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.Equal(t, tt.json, string(out))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, input := range []string{
+			`"abc"`,
+			`"12.34"`,
+			`"1/3"`,
+			`"0x10"`,
+			`"0.005"`,
+			`1e9999`,
+		} {
+			var got Money
+			assert.ErrorIs(t, json.Unmarshal([]byte(input), &got), ErrMoneyInvalid, input)
+		}
+
+		var got Money
+		assert.ErrorIs(t, json.Unmarshal([]byte(`1e30`), &got), ErrMoneyOverflow)
+	})
+
+	t.Run("same wire format as float64", func(t *testing.T) {
+		type withFloat struct {
+			Current   float64 `json:"current"`
+			Withdrawn float64 `json:"withdrawn"`
+			Accrual   float64 `json:"accrual,omitempty"`
+		}
+		type withMoney struct {
+			Current   Money `json:"current"`
+			Withdrawn Money `json:"withdrawn"`
+			Accrual   Money `json:"accrual,omitempty"`
+		}
+
+		f, err := json.Marshal(withFloat{Current: 500.5, Withdrawn: 42})
+		require.NoError(t, err)
+		m, err := json.Marshal(withMoney{Current: 50050, Withdrawn: 4200})
+		require.NoError(t, err)
+		assert.JSONEq(t, string(f), string(m))
+		assert.Equal(t, string(f), string(m))
+	})
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, input := range []string{"1/3", "0x10", "0.005", "+1", ".5", "1.", " 1", "1e9999", ""} {
+		_, err := ParseMoney(input)
+		assert.ErrorIs(t, err, ErrMoneyInvalid, input)
+	}
+
+	got, err := ParseMoney("-0.01")
+	require.NoError(t, err)
+	assert.Equal(t, Money(-1), got)
+}
+
+func TestMoneyExactRequests(t *testing.T) {
+	var withdraw Withdraw
+	require.NoError(t, json.Unmarshal([]byte(`{"order":"2377225624","sum":751.5}`), &withdraw))
+	assert.Equal(t, Withdraw{OrderID: "2377225624", Sum: 75150}, withdraw)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"order":"2377225624","sum":0.005}`), &withdraw), ErrMoneyInvalid)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"order":"2377225624","sum":"1/3"}`), &withdraw), ErrMoneyInvalid)
+
+	var adj BalanceAdjustmentRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":-10.5,"reason":"fraud","note":"x"}`), &adj))
+	assert.Equal(t, BalanceAdjustmentRequest{Amount: -1050, Reason: AdjustmentReasonFraud, Note: "x"}, adj)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"amount":10.125,"reason":"fraud","note":"x"}`), &adj), ErrMoneyInvalid)
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, err := ParseMoney("0.1")
+	require.NoError(t, err)
+	b, err := ParseMoney("0.2")
+	require.NoError(t, err)
+
+	assert.Equal(t, "0.3", a.Add(b).String())
+	assert.True(t, a.Sub(b).IsNegative())
+	assert.Equal(t, 0, a.Add(b).Cmp(MoneyFromMinor(30)))
+	assert.Equal(t, b, b.Neg().Neg())
+}
+
+func TestMoneyPgCodec(t *testing.T) {
+	m := pgtype.NewMap()
+
+	tests := []struct {
+		name   string
+		format int16
+		value  Money
+	}{
+		{name: "binary", format: pgtype.BinaryFormatCode, value: 50050},
+		{name: "text", format: pgtype.TextFormatCode, value: -72998},
+		{name: "zero", format: pgtype.BinaryFormatCode, value: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := m.Encode(pgtype.NumericOID, tt.format, tt.value, nil)
+			require.NoError(t, err)
+
+			var got Money
+			require.NoError(t, m.Scan(pgtype.NumericOID, tt.format, buf, &got))
+			assert.Equal(t, tt.value, got)
+		})
+	}
+
+	t.Run("scan numeric with larger exponent", func(t *testing.T) {
+		var got Money
+		require.NoError(t, m.Scan(pgtype.NumericOID, pgtype.TextFormatCode, []byte("1200"), &got))
+		assert.Equal(t, Money(120000), got)
+	})
+}
@@ -1,10 +1,65 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrOrderNotDeadLettered   = errors.New("order is not in dead letter")
+	ErrOrderNotFound          = errors.New("order not found")
+	ErrIllegalOrderTransition = errors.New("illegal order status transition")
+)
+
+// Статусы заказа в gophermart
+const (
+	OrderStatusNew        = "NEW"
+	OrderStatusRegistered = "REGISTERED"
+	OrderStatusProcessing = "PROCESSING"
+	OrderStatusInvalid    = "INVALID"
+	OrderStatusProcessed  = "PROCESSED"
+)
+
+// PendingOrderStatuses - заказы в этих статусах ждут расчета начислений
+var PendingOrderStatuses = []string{OrderStatusNew, OrderStatusProcessing, OrderStatusRegistered}
+
+// IsFinalOrderStatus - после этих статусов заказ больше не меняется
+func IsFinalOrderStatus(status string) bool {
+	return status == OrderStatusProcessed || status == OrderStatusInvalid
+}
 
 type Order struct {
 	Number     string    `json:"number" db:"order_id"`
 	Status     string    `json:"status" db:"status"`
-	Accrual    float64   `json:"accrual,omitempty" db:"accrual"`
+	Accrual    Money     `json:"accrual,omitempty" db:"accrual"`
 	UploadedAt time.Time `json:"uploaded_at" db:"uploaded_at"`
 }
+
+// OrderStatusChange - запись истории статусов заказа
+type OrderStatusChange struct {
+	Status    string    `json:"status" db:"status"`
+	ChangedAt time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// OrderDetails - заказ вместе с историей статусов, от NEW до текущего
+type OrderDetails struct {
+	Order
+	History []OrderStatusChange `json:"history"`
+}
+
+// AccrualJob - заказ, взятый воркером в аренду, и сколько неудачных попыток по нему уже было
+type AccrualJob struct {
+	OrderID  string `db:"order_id"`
+	Attempts int    `db:"attempts"`
+}
+
+// DeadLetterOrder - заказ, по которому accrual так и не дал внятного ответа за max attempts попыток
+type DeadLetterOrder struct {
+	Number         string    `json:"number" db:"order_id"`
+	UserID         int64     `json:"user_id" db:"user_id"`
+	Status         string    `json:"status" db:"status"`
+	Attempts       int       `json:"attempts" db:"attempts"`
+	LastError      string    `json:"last_error" db:"last_error"`
+	DeadLetteredAt time.Time `json:"dead_lettered_at" db:"dead_lettered_at"`
+	UploadedAt     time.Time `json:"uploaded_at" db:"uploaded_at"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "errors"
+
+var (
+	ErrEmptyPassword      = errors.New("empty password")
+	ErrInvalidResetToken  = errors.New("invalid or expired password reset token")
+	ErrTokenRevoked       = errors.New("auth token revoked")
+	ErrNotifierNotDefined = errors.New("notifier is not defined")
+)
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest - смена пароля по одноразовому токену, который юзер получил через нотификатор
+type PasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Notification - сообщение юзеру, доставляемое нотификатором (лог, файл, почта...)
+type Notification struct {
+	UserID  int64  `json:"user_id"`
+	Login   string `json:"login"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
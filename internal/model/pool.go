@@ -0,0 +1,22 @@
+package model
+
+import "errors"
+
+var ErrInvalidPoolSize = errors.New("invalid worker pool size")
+
+// WorkerPoolStatus - состояние пула воркеров accrual для админки
+type WorkerPoolStatus struct {
+	Running        int    `json:"running"`
+	Target         int    `json:"target"`
+	Min            int    `json:"min"`
+	Max            int    `json:"max"`
+	Paused         bool   `json:"paused"`
+	Backlog        int64  `json:"backlog"`
+	AccrualLatency string `json:"accrual_latency"`
+}
+
+// WorkerPoolSizeRequest - новые границы пула воркеров
+type WorkerPoolSizeRequest struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
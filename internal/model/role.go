@@ -0,0 +1,35 @@
+package model
+
+import "errors"
+
+// Роли юзеров. support может смотреть данные любых юзеров и корректировать их баланс (кроме своего),
+// admin - еще и менять роли и управлять воркерами accrual
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+const (
+	// UserRoleKey - роль юзера в контексте запроса и в заголовке для WithMakeAuth
+	UserRoleKey ContextKey = "role"
+	// ActorIDKey - кто на самом деле выполняет запрос, когда админ действует от имени юзера
+	ActorIDKey ContextKey = "actor_id"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
+var (
+	ErrUnknownRole  = errors.New("unknown role")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+type User struct {
+	ID    int64  `json:"id" db:"user_id"`
+	Login string `json:"login" db:"login"`
+	Role  string `json:"role" db:"role"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
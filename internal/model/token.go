@@ -0,0 +1,20 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// RefreshToken - серверная запись о refresh-токене. Все токены, полученные ротацией
+// от одного логина, образуют семейство и отзываются вместе.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    int64
+	ExpiresAt time.Time
+}
@@ -0,0 +1,59 @@
+package model
+
+import "errors"
+
+// OTPCodeHeader - заголовок с кодом второго фактора для операций, требующих подтверждения (step-up)
+const OTPCodeHeader = "X-OTP-Code"
+
+var (
+	ErrTOTPNotEnabled        = errors.New("2fa is not enabled")
+	ErrTOTPAlreadyEnabled    = errors.New("2fa is already enabled")
+	ErrTOTPSetupNotFound     = errors.New("2fa setup not started")
+	ErrWrongTOTPCode         = errors.New("wrong 2fa code")
+	ErrInvalidLoginChallenge = errors.New("invalid or expired 2fa login challenge")
+	ErrSecondFactorRequired  = errors.New("second factor required")
+	// ErrSecretEncrypterNotDefined - сервис запущен без ключа шифрования секретов TOTP
+	ErrSecretEncrypterNotDefined = errors.New("totp secret encrypter is not defined")
+)
+
+// TOTP - настройки двухфакторной аутентификации юзера. Secret хранится зашифрованным
+type TOTP struct {
+	Secret         string
+	Enabled        bool
+	WithdrawStepUp bool  // требовать код при списании баллов
+	LastUsedStep   int64 // последний принятый интервал, коды из него и более ранних повторно не принимаются
+}
+
+// TOTPSetup - ответ на начало подключения 2FA
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TOTPCodeRequest - подтверждение действия кодом из аутентификатора или кодом восстановления
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes показываются юзеру один раз, в базе лежат только их хеши
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// WithdrawStepUpRequest включает или выключает подтверждение списаний кодом
+type WithdrawStepUpRequest struct {
+	Required bool   `json:"required"`
+	Code     string `json:"code"`
+}
+
+// LoginChallenge - ответ на логин с верным паролем, когда нужен второй шаг
+type LoginChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Token       string `json:"mfa_token"`
+}
+
+// SecondFactorRequest - второй шаг логина
+type SecondFactorRequest struct {
+	Token string `json:"mfa_token"`
+	Code  string `json:"code"`
+}
@@ -0,0 +1,97 @@
+// Package notify доставляет юзерам служебные сообщения, например токены сброса пароля.
+// Настоящей почты пока нет, поэтому есть только реализации для локальной работы: в лог и в файл.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notifier доставляет сообщение юзеру
+type Notifier interface {
+	Notify(ctx context.Context, msg model.Notification) error
+}
+
+// New создает нотификатор по описанию из конфига: "log" или "file:/path/to/file".
+// Пустое описание - нотификатора нет (nil, nil): лог молча не выбирается, в него попали бы токены сброса пароля
+func New(spec string) (Notifier, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "log":
+		logger.Log.Warn("log notifier is enabled: password reset tokens are written to the service log, use it only locally")
+		return NewLogNotifier(), nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("notify.New: empty file path in %q", spec)
+		}
+		return NewFileNotifier(path), nil
+	default:
+		return nil, fmt.Errorf("notify.New: unknown notifier %q", spec)
+	}
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier пишет сообщения в лог сервиса. Только для локальной разработки: в лог попадают секреты
+func NewLogNotifier() *logNotifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(_ context.Context, msg model.Notification) error {
+	logger.Log.Info("notification",
+		zap.Int64("user_id", msg.UserID),
+		zap.String("login", msg.Login),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body),
+	)
+	return nil
+}
+
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier дописывает сообщения в файл, по одному JSON на строку
+func NewFileNotifier(path string) *fileNotifier {
+	return &fileNotifier{path: path}
+}
+
+type fileRecord struct {
+	model.Notification
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (n *fileNotifier) Notify(_ context.Context, msg model.Notification) error {
+	line, err := json.Marshal(fileRecord{Notification: msg, SentAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("fileNotifier-Marshal-err: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("fileNotifier-OpenFile-err: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("fileNotifier-Write-err: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"gophermart/internal/model"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	n, err := New("log")
+	require.NoError(t, err)
+	assert.IsType(t, &logNotifier{}, n)
+
+	n, err = New("file:/tmp/notifications.jsonl")
+	require.NoError(t, err)
+	assert.IsType(t, &fileNotifier{}, n)
+
+	n, err = New("")
+	require.NoError(t, err)
+	assert.Nil(t, n)
+
+	_, err = New("file:")
+	assert.Error(t, err)
+
+	_, err = New("smtp:localhost")
+	assert.Error(t, err)
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	n := NewFileNotifier(path)
+
+	require.NoError(t, n.Notify(context.Background(), model.Notification{UserID: 1, Login: "login1", Subject: "first"}))
+	require.NoError(t, n.Notify(context.Background(), model.Notification{UserID: 2, Login: "login2", Subject: "second"}))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var got []fileRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec fileRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		got = append(got, rec)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, got, 2)
+	assert.Equal(t, "first", got[0].Subject)
+	assert.Equal(t, "login2", got[1].Login)
+	assert.False(t, got[1].SentAt.IsZero())
+}
@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Счета журнала. У каждого юзера свой счет баллов, системные счета - источники и получатели баллов
+const (
+	ledgerAccountUser       = "user"
+	ledgerAccountAccrual    = "system:accrual"
+	ledgerAccountWithdrawal = "system:withdrawal"
+	ledgerAccountAdjustment = "system:adjustment"
+)
+
+// postLedgerTx проводит операцию внутри транзакции tx: amount приходит на счет юзера
+// и с обратным знаком уходит на counterAccount, так что сумма проводки всегда равна нулю.
+func postLedgerTx(ctx context.Context, tx pgx.Tx, kind string, userID int64, orderID string, amount model.Money, counterAccount string) (int64, error) {
+	var txID int64
+	if err := tx.QueryRow(ctx, nextLedgerTxQuery).Scan(&txID); err != nil {
+		return 0, fmt.Errorf("postLedgerTx-nextLedgerTxQuery-err: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(insertLedgerEntryQuery, txID, ledgerAccountUser, userID, kind, amount, orderID)
+	batch.Queue(insertLedgerEntryQuery, txID, counterAccount, userID, kind, amount.Neg(), orderID)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("postLedgerTx-insertLedgerEntryQuery-err: %w", err)
+	}
+
+	return txID, nil
+}
+
+// lockBalance блокирует строку user_balance юзера до конца транзакции tx и возвращает баланс по журналу.
+// Списания проверяются только по журналу: user_balance - проекция, по ее строке лишь сериализуются операции.
+// Расхождение проекции с журналом попадает в лог и метрику, а решение все равно принимается по журналу
+func lockBalance(ctx context.Context, tx pgx.Tx, userID int64) (model.Money, error) {
+	var projected model.Money
+	err := tx.QueryRow(ctx, lockUserBalanceQuery, userID).Scan(&projected)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("lockBalance-lockUserBalanceQuery-err: %w", err)
+	}
+
+	var balance model.Money
+	if err := tx.QueryRow(ctx, getUserLedgerBalanceQuery, userID).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("lockBalance-getUserLedgerBalanceQuery-err: %w", err)
+	}
+
+	if projected != balance {
+		metrics.BalanceDrift.Inc()
+		logger.Log.Error("user_balance differs from ledger",
+			zap.Int64("user_id", userID), zap.Stringer("user_balance", projected), zap.Stringer("ledger", balance))
+	}
+
+	return balance, nil
+}
+
+// postAccrual приводит сумму начислений по заказу в журнале к accrual.
+// Если система расчета прислала для заказа другую сумму, предыдущее начисление сторнируется.
+// Возвращает изменение баланса юзера.
+func postAccrual(ctx context.Context, tx pgx.Tx, userID int64, orderID string, accrual model.Money) (model.Money, error) {
+	var accrued model.Money
+	if err := tx.QueryRow(ctx, getOrderAccruedQuery, orderID).Scan(&accrued); err != nil {
+		return 0, fmt.Errorf("postAccrual-getOrderAccruedQuery-err: %w", err)
+	}
+
+	if accrued == accrual {
+		return 0, nil
+	}
+
+	if !accrued.IsZero() {
+		if _, err := postLedgerTx(ctx, tx, model.LedgerKindReversal, userID, orderID, accrued.Neg(), ledgerAccountAccrual); err != nil {
+			return 0, fmt.Errorf("postAccrual-reversal-err: %w", err)
+		}
+	}
+
+	if !accrual.IsZero() {
+		if _, err := postLedgerTx(ctx, tx, model.LedgerKindAccrual, userID, orderID, accrual, ledgerAccountAccrual); err != nil {
+			return 0, fmt.Errorf("postAccrual-accrual-err: %w", err)
+		}
+	}
+
+	return accrual.Sub(accrued), nil
+}
@@ -0,0 +1,64 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/logger"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newOrdersChannel - канал NOTIFY, в который AddOrder сообщает о новом заказе
+const newOrdersChannel = "new_orders"
+
+const (
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+)
+
+// ListenNewOrders держит отдельное соединение с LISTEN new_orders и вызывает onNotify на каждое уведомление.
+// При обрыве переподключается и сразу вызывает onNotify, чтобы не потерять заказы, добавленные без слушателя.
+// Возвращается только при отмене ctx
+func (r PostgresRepository) ListenNewOrders(ctx context.Context, onNotify func()) {
+	backoff := listenMinBackoff
+	for {
+		err := r.listen(ctx, onNotify, func() { backoff = listenMinBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Log.Error("ListenNewOrders error, reconnecting", zap.String("error", err.Error()), zap.Duration("backoff", backoff))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+// listen работает на одном соединении до первой ошибки. Соединение забирается из пула насовсем:
+// вернуть в пул соединение с активным LISTEN нельзя
+func (r PostgresRepository) listen(ctx context.Context, onNotify, onConnected func()) error {
+	poolConn, err := r.DB.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("listen-Acquire-err: %w", err)
+	}
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, listenNewOrdersQuery); err != nil {
+		return fmt.Errorf("listen-listenNewOrdersQuery-err: %w", err)
+	}
+
+	onConnected()
+	onNotify()
+
+	for {
+		if _, err = conn.WaitForNotification(ctx); err != nil {
+			return fmt.Errorf("listen-WaitForNotification-err: %w", err)
+		}
+		onNotify()
+	}
+}
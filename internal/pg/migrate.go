@@ -0,0 +1,299 @@
+package pg
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey - ключ advisory lock, под которым накатываются миграции,
+// чтобы несколько одновременно стартующих инстансов не мешали друг другу
+const migrationLockKey int64 = 0x676d5f6d696772 // "gm_migr"
+
+var ErrNoMigrationsToRollback = errors.New("no applied migrations to roll back")
+
+// Migration - одна версия схемы. Файлы называются <version>_<name>.up.sql и <version>_<name>.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("NewMigrator-loadMigrations-err: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up накатывает все еще не примененные миграции и возвращает список примененных
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+
+			if err := runMigration(ctx, conn, mig.Up, insertMigrationQuery, mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("Migrator-Up-err: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Down откатывает steps последних примененных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+
+			if err := runMigration(ctx, conn, mig.Down, deleteMigrationQuery, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			rolledBack = append(rolledBack, mig)
+		}
+
+		if len(rolledBack) == 0 {
+			return ErrNoMigrationsToRollback
+		}
+
+		return nil
+	})
+	if err != nil {
+		return rolledBack, fmt.Errorf("Migrator-Down-err: %w", err)
+	}
+
+	return rolledBack, nil
+}
+
+// Status возвращает все известные бинарнику миграции с датой применения (nil - не применена)
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Migrator-Status-Acquire-err: %w", err)
+	}
+	defer conn.Release()
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("Migrator-Status-err: %w", err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if appliedAt, ok := done[mig.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Pending возвращает миграции, которые есть в бинарнике, но еще не применены к базе
+func (m *Migrator) Pending(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []MigrationStatus
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("withLock-Acquire-err: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, advisoryLockQuery, migrationLockKey); err != nil {
+		return fmt.Errorf("withLock-advisoryLockQuery-err: %w", err)
+	}
+	defer conn.Exec(context.Background(), advisoryUnlockQuery, migrationLockKey)
+
+	if _, err := conn.Exec(ctx, createSchemaMigrationsTableQuery); err != nil {
+		return fmt.Errorf("withLock-createSchemaMigrationsTableQuery-err: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// runMigration выполняет sql миграции и запись в schema_migrations в одной транзакции
+func runMigration(ctx context.Context, conn *pgxpool.Conn, sql, bookkeepingQuery string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("runMigration-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("runMigration-Exec-err: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, bookkeepingQuery, args...); err != nil {
+		return fmt.Errorf("runMigration-bookkeeping-err: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("runMigration-Commit-err: %w", err)
+	}
+
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, existSchemaMigrationsQuery).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("appliedVersions-existSchemaMigrationsQuery-err: %w", err)
+	}
+
+	done := make(map[int64]time.Time)
+	if !exists {
+		return done, nil
+	}
+
+	rows, err := conn.Query(ctx, getAppliedMigrationsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("appliedVersions-getAppliedMigrationsQuery-err: %w", err)
+	}
+
+	var version int64
+	var appliedAt time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		done[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("appliedVersions-ForEachRow-err: %w", err)
+	}
+
+	return done, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %q", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %q has no name", fileName)
+		}
+
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %q has invalid version: %w", fileName, err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		}
+		if mig.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, mig.Name, name)
+		}
+
+		if direction == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,75 @@
+package pg
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("embedded migrations", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationsFS, "migrations")
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		for i, mig := range migrations {
+			assert.NotEmpty(t, mig.Up, mig.Name)
+			assert.NotEmpty(t, mig.Down, mig.Name)
+			if i > 0 {
+				assert.Greater(t, mig.Version, migrations[i-1].Version)
+			}
+		}
+	})
+
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  bool
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"m/0010_second.up.sql":   {Data: []byte("select 2")},
+				"m/0010_second.down.sql": {Data: []byte("select 2")},
+				"m/0002_first.up.sql":    {Data: []byte("select 1")},
+				"m/0002_first.down.sql":  {Data: []byte("select 1")},
+			},
+			versions: []int64{2, 10},
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": {Data: []byte("select 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid version",
+			files: fstest.MapFS{
+				"m/abc_init.up.sql":   {Data: []byte("select 1")},
+				"m/abc_init.down.sql": {Data: []byte("select 1")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var versions []int64
+			for _, mig := range migrations {
+				versions = append(versions, mig.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
@@ -0,0 +1,4 @@
+drop table if exists user_withdrawals;
+drop table if exists user_balance;
+drop table if exists user_orders;
+drop table if exists user_auth_data;
@@ -0,0 +1,35 @@
+create table if not exists user_auth_data
+(
+    login    TEXT      not null primary key,
+    password TEXT      not null,
+    user_id  BIGSERIAL not null
+);
+
+create table if not exists user_orders
+(
+    order_id    TEXT                     not null primary key,
+    user_id     bigint                   not null,
+    status      TEXT                     not null default 'NEW',
+    accrual     numeric(10, 2)           not null default 0,
+    uploaded_at timestamp with time zone not null default now(),
+    updated_at  timestamp with time zone not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_orders_user ON user_orders (user_id);
+
+create table if not exists user_balance
+(
+    user_id         bigint         not null primary key,
+    current_balance numeric(10, 2) not null default 0,
+    withdrawn       numeric(10, 2) not null default 0
+);
+
+create table if not exists user_withdrawals
+(
+    user_id      bigint                   not null,
+    order_id     TEXT                     not null primary key,
+    sum          numeric(10, 2)           not null default 0,
+    processed_at timestamp with time zone not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_withdrawals_user ON user_withdrawals (user_id);
@@ -0,0 +1,9 @@
+alter table user_withdrawals
+    alter column sum type numeric(10, 2);
+
+alter table user_balance
+    alter column current_balance type numeric(10, 2),
+    alter column withdrawn type numeric(10, 2);
+
+alter table user_orders
+    alter column accrual type numeric(10, 2);
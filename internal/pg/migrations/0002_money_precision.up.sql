@@ -0,0 +1,10 @@
+-- суммы хранятся в model.Money (int64 сотых), numeric(18, 2) целиком помещается в этот диапазон
+alter table user_orders
+    alter column accrual type numeric(18, 2);
+
+alter table user_balance
+    alter column current_balance type numeric(18, 2),
+    alter column withdrawn type numeric(18, 2);
+
+alter table user_withdrawals
+    alter column sum type numeric(18, 2);
@@ -0,0 +1,4 @@
+drop table if exists ledger_entries;
+drop function if exists ledger_forbid_change();
+drop function if exists ledger_check_balanced();
+drop sequence if exists ledger_tx_seq;
@@ -0,0 +1,89 @@
+create sequence if not exists ledger_tx_seq;
+
+-- Журнал проводок. Каждая операция (tx_id) - это набор записей с нулевой суммой:
+-- приход на счет юзера всегда списывается с какого-то системного счета и наоборот.
+create table if not exists ledger_entries
+(
+    id         BIGSERIAL                not null primary key,
+    tx_id      bigint                   not null,
+    account    TEXT                     not null,
+    user_id    bigint                   not null,
+    kind       TEXT                     not null,
+    amount     numeric(18, 2)           not null,
+    order_id   TEXT,
+    created_at timestamp with time zone not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_user ON ledger_entries (user_id, account, created_at);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_tx ON ledger_entries (tx_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_order ON ledger_entries (order_id) where order_id is not null;
+
+create or replace function ledger_check_balanced() returns trigger as
+$$
+begin
+    if (select sum(amount) from ledger_entries where tx_id = new.tx_id) <> 0 then
+        raise exception 'ledger transaction % is not balanced', new.tx_id;
+    end if;
+    return null;
+end;
+$$ language plpgsql;
+
+create constraint trigger ledger_entries_balanced
+    after insert
+    on ledger_entries
+    deferrable initially deferred
+    for each row
+execute function ledger_check_balanced();
+
+create or replace function ledger_forbid_change() returns trigger as
+$$
+begin
+    raise exception 'ledger_entries is append-only';
+end;
+$$ language plpgsql;
+
+create trigger ledger_entries_append_only
+    before update or delete
+    on ledger_entries
+    for each row
+execute function ledger_forbid_change();
+
+-- переносим в журнал уже существующие начисления и списания
+with src as (select nextval('ledger_tx_seq') as tx_id, user_id, order_id, accrual, updated_at
+             from user_orders
+             where accrual <> 0)
+insert
+into ledger_entries (tx_id, account, user_id, kind, amount, order_id, created_at)
+select tx_id, 'user', user_id, 'accrual', accrual, order_id, updated_at
+from src
+union all
+select tx_id, 'system:accrual', user_id, 'accrual', -accrual, order_id, updated_at
+from src;
+
+with src as (select nextval('ledger_tx_seq') as tx_id, user_id, order_id, sum, processed_at
+             from user_withdrawals)
+insert
+into ledger_entries (tx_id, account, user_id, kind, amount, order_id, created_at)
+select tx_id, 'user', user_id, 'withdrawal', -sum, order_id, processed_at
+from src
+union all
+select tx_id, 'system:withdrawal', user_id, 'withdrawal', sum, order_id, processed_at
+from src;
+
+-- если баланс правили руками и он разошелся с историей, фиксируем разницу входящим остатком
+with diff as (select b.user_id, b.current_balance - coalesce(l.total, 0) as amount
+              from user_balance b
+                       left join (select user_id, sum(amount) as total
+                                  from ledger_entries
+                                  where account = 'user'
+                                  group by user_id) l on l.user_id = b.user_id),
+     src as (select nextval('ledger_tx_seq') as tx_id, user_id, amount
+             from diff
+             where amount <> 0)
+insert
+into ledger_entries (tx_id, account, user_id, kind, amount)
+select tx_id, 'user', user_id, 'opening', amount
+from src
+union all
+select tx_id, 'system:opening', user_id, 'opening', -amount
+from src;
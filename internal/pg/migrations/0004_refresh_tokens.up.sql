@@ -0,0 +1,13 @@
+create table if not exists refresh_tokens
+(
+    token_hash TEXT                     not null primary key,
+    family_id  TEXT                     not null,
+    user_id    bigint                   not null,
+    expires_at timestamp with time zone not null,
+    created_at timestamp with time zone not null default now(),
+    used_at    timestamp with time zone,
+    revoked_at timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens (user_id);
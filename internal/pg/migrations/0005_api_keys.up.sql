@@ -0,0 +1,14 @@
+create table if not exists api_keys
+(
+    id           BIGSERIAL                not null primary key,
+    user_id      bigint                   not null,
+    name         TEXT                     not null,
+    prefix       TEXT                     not null,
+    key_hash     TEXT                     not null unique,
+    scopes       TEXT[]                   not null,
+    created_at   timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone,
+    revoked_at   timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
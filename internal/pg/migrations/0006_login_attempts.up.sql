@@ -0,0 +1,8 @@
+-- неудачные попытки входа по логину (key = 'login:<login>') и по IP (key = 'ip:<ip>')
+create table if not exists login_attempts
+(
+    key             TEXT                     not null primary key,
+    failures        integer                  not null default 0,
+    last_failure_at timestamp with time zone not null default now(),
+    locked_until    timestamp with time zone
+);
@@ -0,0 +1,31 @@
+-- TOTP двухфакторная аутентификация. secret зашифрован ключом TOTP_SECRET_KEY,
+-- confirmed_at заполняется после подтверждения первым кодом
+create table if not exists user_totp
+(
+    user_id          bigint                   not null primary key,
+    secret           TEXT                     not null,
+    confirmed_at     timestamp with time zone,
+    withdraw_step_up boolean                  not null default false,
+    last_used_step   bigint                   not null default 0,
+    created_at       timestamp with time zone not null default now()
+);
+
+-- одноразовые коды восстановления, хранятся только хеши
+create table if not exists recovery_codes
+(
+    id         BIGSERIAL                not null primary key,
+    user_id    bigint                   not null,
+    code_hash  TEXT                     not null unique,
+    created_at timestamp with time zone not null default now(),
+    used_at    timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes (user_id);
+
+-- незавершенные логины: пароль проверен, ждем код второго фактора
+create table if not exists login_challenges
+(
+    token_hash TEXT                     not null primary key,
+    user_id    bigint                   not null,
+    expires_at timestamp with time zone not null
+);
@@ -0,0 +1,4 @@
+drop table if exists password_reset_tokens;
+
+alter table user_auth_data
+    drop column if exists password_changed_at;
@@ -0,0 +1,14 @@
+-- access-токены, выпущенные раньше password_changed_at, больше не принимаются
+alter table user_auth_data
+    add column if not exists password_changed_at timestamp with time zone;
+
+create table if not exists password_reset_tokens
+(
+    token_hash TEXT                     not null primary key,
+    user_id    bigint                   not null,
+    expires_at timestamp with time zone not null,
+    created_at timestamp with time zone not null default now(),
+    used_at    timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens (user_id);
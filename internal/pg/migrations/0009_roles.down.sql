@@ -0,0 +1,7 @@
+drop index if exists idx_user_auth_data_user_id;
+
+alter table user_auth_data
+    drop column if exists sessions_revoked_at;
+
+alter table user_auth_data
+    drop column if exists role;
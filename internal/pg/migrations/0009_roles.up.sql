@@ -0,0 +1,9 @@
+alter table user_auth_data
+    add column if not exists role TEXT not null default 'user'
+        constraint user_auth_data_role_check check (role in ('user', 'support', 'admin'));
+
+-- смена роли отзывает все токены юзера, так же как смена пароля
+alter table user_auth_data
+    add column if not exists sessions_revoked_at timestamp with time zone;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_auth_data_user_id ON user_auth_data (user_id);
@@ -0,0 +1 @@
+drop table if exists balance_adjustments;
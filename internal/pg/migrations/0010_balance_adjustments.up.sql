@@ -0,0 +1,15 @@
+-- аудит ручных корректировок баланса. Сами баллы проводятся через ledger_entries (kind = 'adjustment'),
+-- здесь - кто, почему и с какой проводкой
+create table if not exists balance_adjustments
+(
+    id           BIGSERIAL                not null primary key,
+    ledger_tx_id bigint                   not null unique,
+    user_id      bigint                   not null,
+    actor_id     bigint                   not null,
+    amount       numeric(18, 2)           not null,
+    reason       TEXT                     not null,
+    note         TEXT                     not null,
+    created_at   timestamp with time zone not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_adjustments_user ON balance_adjustments (user_id, created_at);
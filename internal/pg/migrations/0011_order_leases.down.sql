@@ -0,0 +1,6 @@
+drop index if exists idx_user_orders_lease_owner;
+drop index if exists idx_user_orders_pending;
+
+alter table user_orders
+    drop column if exists lease_expires_at,
+    drop column if exists lease_owner;
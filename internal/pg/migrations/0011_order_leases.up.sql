@@ -0,0 +1,10 @@
+-- аренда заказа воркером: пока lease_expires_at в будущем, заказ не возьмет никто, кроме lease_owner.
+-- updated_at по-прежнему означает, когда заказ пора проверить снова
+alter table user_orders
+    add column if not exists lease_owner      TEXT,
+    add column if not exists lease_expires_at timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_user_orders_pending ON user_orders (updated_at)
+    WHERE status in ('NEW', 'PROCESSING', 'REGISTERED');
+CREATE INDEX IF NOT EXISTS idx_user_orders_lease_owner ON user_orders (lease_owner)
+    WHERE lease_owner is not null;
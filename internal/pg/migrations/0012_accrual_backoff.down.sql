@@ -0,0 +1 @@
+drop table if exists accrual_backoff;
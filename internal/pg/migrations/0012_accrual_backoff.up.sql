@@ -0,0 +1,6 @@
+-- общая для всех инстансов пауза в запросах к accrual после 429. Одна строка с id = 1
+create table if not exists accrual_backoff
+(
+    id           int                      not null primary key check (id = 1),
+    paused_until timestamp with time zone not null
+);
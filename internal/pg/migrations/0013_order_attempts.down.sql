@@ -0,0 +1,10 @@
+drop index if exists idx_user_orders_dead_letter;
+drop index if exists idx_user_orders_pending;
+CREATE INDEX IF NOT EXISTS idx_user_orders_pending ON user_orders (updated_at)
+    WHERE status in ('NEW', 'PROCESSING', 'REGISTERED');
+
+alter table user_orders
+    drop column if exists dead_lettered_at,
+    drop column if exists next_attempt_at,
+    drop column if exists last_error,
+    drop column if exists attempts;
@@ -0,0 +1,17 @@
+-- повторные попытки расчета: next_attempt_at - когда заказ пора проверить снова (раньше эту роль играл updated_at),
+-- после max attempts заказ попадает в dead letter (dead_lettered_at) и ждет ручного перезапуска
+alter table user_orders
+    add column if not exists attempts         int                      not null default 0,
+    add column if not exists last_error       TEXT,
+    add column if not exists next_attempt_at  timestamp with time zone not null default now(),
+    add column if not exists dead_lettered_at timestamp with time zone;
+
+update user_orders
+set next_attempt_at = updated_at
+where status in ('NEW', 'PROCESSING', 'REGISTERED');
+
+drop index if exists idx_user_orders_pending;
+CREATE INDEX IF NOT EXISTS idx_user_orders_pending ON user_orders (next_attempt_at)
+    WHERE status in ('NEW', 'PROCESSING', 'REGISTERED') and dead_lettered_at is null;
+CREATE INDEX IF NOT EXISTS idx_user_orders_dead_letter ON user_orders (dead_lettered_at)
+    WHERE dead_lettered_at is not null;
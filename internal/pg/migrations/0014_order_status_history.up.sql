@@ -0,0 +1,20 @@
+-- история статусов заказа: строка на каждую смену статуса, первая - NEW при загрузке
+create table if not exists order_status_history
+(
+    id         BIGSERIAL                not null primary key,
+    order_id   TEXT                     not null references user_orders (order_id) on delete cascade,
+    status     TEXT                     not null,
+    changed_at timestamp with time zone not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history (order_id, changed_at);
+
+-- точное время смен статуса до этой миграции не хранилось: NEW - момент загрузки, текущий статус - последнее обновление заказа
+insert into order_status_history (order_id, status, changed_at)
+select order_id, 'NEW', uploaded_at
+from user_orders;
+
+insert into order_status_history (order_id, status, changed_at)
+select order_id, status, greatest(updated_at, uploaded_at)
+from user_orders
+where status <> 'NEW';
@@ -2,6 +2,7 @@ package pg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,6 +15,25 @@ type PostgresRepository struct {
 	DBTimeout time.Duration
 }
 
+// Ping проверяет, что пул может получить соединение и база отвечает
+func (r PostgresRepository) Ping(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "pg.Ping")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	if r.DB == nil {
+		return errors.New("Ping: database is not configured")
+	}
+
+	if err := r.DB.Ping(ctx); err != nil {
+		return fmt.Errorf("Ping-err: %w", err)
+	}
+
+	return nil
+}
+
 func NewConnect(ctx context.Context, dbDSN string, dbTimeout time.Duration) (PostgresRepository, error) {
 	if dbDSN == "" {
 		return PostgresRepository{}, nil
@@ -26,6 +46,7 @@ func NewConnect(ctx context.Context, dbDSN string, dbTimeout time.Duration) (Pos
 	if err != nil {
 		return PostgresRepository{}, err
 	}
+	config.ConnConfig.Tracer = queryTracer{}
 
 	db, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
@@ -45,47 +66,5 @@ func NewConnect(ctx context.Context, dbDSN string, dbTimeout time.Duration) (Pos
 		}
 	}
 
-	tx, err := db.Begin(ctx)
-	if err != nil {
-		tx.Rollback(ctx)
-		return PostgresRepository{}, fmt.Errorf("NewConnect-BeginTx-err: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	_, err = tx.Exec(ctx, createUserAuthTableQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	_, err = tx.Exec(ctx, createUserOrdersTableQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	_, err = tx.Exec(ctx, createUserOrdersUserIndexQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	_, err = tx.Exec(ctx, createUserBalanceTableQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	_, err = tx.Exec(ctx, createUserWithdrawalsTableQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	_, err = tx.Exec(ctx, createUserWithdrawalsUserIndexQuery)
-	if err != nil {
-		return PostgresRepository{}, err
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		return PostgresRepository{}, fmt.Errorf("NewConnect-Commit-err: %w", err)
-	}
-
 	return PostgresRepository{db, dbTimeout}, nil
 }
@@ -9,49 +9,35 @@ SELECT EXISTS (SELECT FROM pg_database WHERE datname = 'gophermart');
 CREATE DATABASE gophermart
 `
 
-	createUserAuthTableQuery = `
-create table if not exists user_auth_data
-(
-    login    TEXT      not null primary key,
-    password TEXT      not null,
-    user_id  BIGSERIAL not null
-)
+	advisoryLockQuery = `
+select pg_advisory_lock($1)
 `
-	createUserOrdersTableQuery = `
-create table if not exists user_orders
+	advisoryUnlockQuery = `
+select pg_advisory_unlock($1)
+`
+	createSchemaMigrationsTableQuery = `
+create table if not exists schema_migrations
 (
-    order_id    TEXT                     not null primary key,
-    user_id     bigint                   not null,
-    status      TEXT                     not null default 'NEW',
-    accrual     numeric(10, 2)           not null default 0,
-    uploaded_at timestamp with time zone not null default now(),
-    updated_at  timestamp with time zone not null default now()
+    version    bigint                   not null primary key,
+    name       TEXT                     not null,
+    applied_at timestamp with time zone not null default now()
 )
 `
-	createUserOrdersUserIndexQuery = `
-CREATE INDEX IF NOT EXISTS idx_user_orders_user ON user_orders(user_id)
+	existSchemaMigrationsQuery = `
+select to_regclass('schema_migrations') is not null
 `
-
-	createUserBalanceTableQuery = `
-create table if not exists user_balance
-(
-    user_id         bigint not null primary key,
-    current_balance numeric(10, 2) not null default 0,
-    withdrawn       numeric(10, 2) not null default 0
-)
+	getAppliedMigrationsQuery = `
+select version, applied_at
+from schema_migrations
+order by version
 `
-
-	createUserWithdrawalsTableQuery = `
-create table if not exists user_withdrawals
-(
-    user_id      bigint                   not null,
-    order_id     TEXT                     not null primary key,
-    sum          numeric(10, 2)           not null default 0,
-    processed_at timestamp with time zone not null default now()
-)
+	insertMigrationQuery = `
+insert into schema_migrations (version, name)
+values ($1, $2)
 `
-	createUserWithdrawalsUserIndexQuery = `
-CREATE INDEX IF NOT EXISTS idx_user_orders_user ON user_withdrawals(user_id)
+	deleteMigrationQuery = `
+delete from schema_migrations
+where version = $1
 `
 
 	saveAuthInfoQuery = `
@@ -65,10 +51,228 @@ select user_id, password
        from user_auth_data 
 where login = $1;
 `
-	addOrderQuery = `
-insert into user_orders (order_id, user_id) 
+	// пароль меняется, только если в базе все еще $3: параллельная смена пароля не откатится
+	updatePasswordQuery = `
+update user_auth_data
+set password = $2
+where user_id = $1
+  and password = $3;
+`
+	getPasswordQuery = `
+select password
+from user_auth_data
+where user_id = $1
+`
+	getTokensValidAfterQuery = `
+select greatest(password_changed_at, sessions_revoked_at)
+from user_auth_data
+where user_id = $1
+`
+	getUserQuery = `
+select user_id, login, role
+from user_auth_data
+where user_id = $1
+`
+	findUserByLoginQuery = `
+select user_id, login, role
+from user_auth_data
+where login = $1
+`
+	setRoleQuery = `
+update user_auth_data
+set role                = $2,
+    sessions_revoked_at = now()
+where user_id = $1
+`
+	changePasswordQuery = `
+update user_auth_data
+set password            = $2,
+    password_changed_at = now()
+where user_id = $1
+`
+	revokeUserRefreshTokensQuery = `
+update refresh_tokens
+set revoked_at = now()
+where user_id = $1
+  and revoked_at is null
+`
+	addPasswordResetTokenQuery = `
+insert into password_reset_tokens (token_hash, user_id, expires_at)
+values ($1, $2, $3)
+`
+	usePasswordResetTokenQuery = `
+update password_reset_tokens
+set used_at = now()
+where token_hash = $1
+  and used_at is null
+  and expires_at > now()
+returning user_id
+`
+	invalidatePasswordResetTokensQuery = `
+update password_reset_tokens
+set used_at = now()
+where user_id = $1
+  and used_at is null
+`
+	addRefreshTokenQuery = `
+insert into refresh_tokens (token_hash, family_id, user_id, expires_at)
+values ($1, $2, $3, $4)
+`
+	getRefreshTokenForUpdateQuery = `
+select family_id, user_id, expires_at < now() as expired, used_at is not null as used, revoked_at is not null as revoked
+from refresh_tokens
+where token_hash = $1
+for update
+`
+	useRefreshTokenQuery = `
+update refresh_tokens
+set used_at = now()
+where token_hash = $1
+`
+	revokeRefreshTokenFamilyQuery = `
+update refresh_tokens
+set revoked_at = now()
+where family_id = $1
+  and revoked_at is null
+`
+	revokeRefreshTokenFamilyByTokenQuery = `
+update refresh_tokens
+set revoked_at = now()
+where family_id = (select family_id from refresh_tokens where token_hash = $1)
+  and revoked_at is null
+`
+	addAPIKeyQuery = `
+insert into api_keys (user_id, name, prefix, key_hash, scopes)
+values ($1, $2, $3, $4, $5)
+returning id, created_at
+`
+	getAPIKeysQuery = `
+select id, name, prefix, scopes, created_at, last_used_at
+from api_keys
+where user_id = $1
+  and revoked_at is null
+order by created_at desc
+`
+	revokeAPIKeyQuery = `
+update api_keys
+set revoked_at = now()
+where id = $1
+  and user_id = $2
+  and revoked_at is null
+`
+	useAPIKeyQuery = `
+update api_keys
+set last_used_at = now()
+where key_hash = $1
+  and revoked_at is null
+returning user_id, scopes
+`
+	getLoginLockQuery = `
+select greatest(coalesce(max(locked_until), now()) - now(), interval '0')
+from login_attempts
+where key = any ($1)
+`
+	addLoginFailureQuery = `
+insert into login_attempts (key, failures, last_failure_at)
+values ($1, 1, now())
+on conflict (key) do update
+    set failures        = case
+                              when login_attempts.last_failure_at < now() - $2::interval then 1
+                              else login_attempts.failures + 1 end,
+        last_failure_at = now()
+returning failures
+`
+	setLoginLockQuery = `
+update login_attempts
+set locked_until = now() + $2::interval
+where key = $1
+returning locked_until
+`
+	resetLoginFailuresQuery = `
+delete from login_attempts
+where key = $1
+`
+	getLoginQuery = `
+select login
+from user_auth_data
+where user_id = $1
+`
+	setTOTPSecretQuery = `
+insert into user_totp (user_id, secret)
 values ($1, $2)
-on conflict do nothing;
+on conflict (user_id) do update
+    set secret     = EXCLUDED.secret,
+        created_at = now()
+where user_totp.confirmed_at is null
+returning user_id
+`
+	getTOTPQuery = `
+select secret, confirmed_at is not null as enabled, withdraw_step_up, last_used_step
+from user_totp
+where user_id = $1
+`
+	enableTOTPQuery = `
+update user_totp
+set confirmed_at   = now(),
+    last_used_step = $2
+where user_id = $1
+  and confirmed_at is null
+`
+	useTOTPStepQuery = `
+update user_totp
+set last_used_step = $2
+where user_id = $1
+  and last_used_step < $2
+`
+	setWithdrawStepUpQuery = `
+update user_totp
+set withdraw_step_up = $2
+where user_id = $1
+  and confirmed_at is not null
+`
+	deleteRecoveryCodesQuery = `
+delete from recovery_codes
+where user_id = $1
+`
+	addRecoveryCodeQuery = `
+insert into recovery_codes (user_id, code_hash)
+values ($1, $2)
+`
+	useRecoveryCodeQuery = `
+update recovery_codes
+set used_at = now()
+where user_id = $1
+  and code_hash = $2
+  and used_at is null
+`
+	addLoginChallengeQuery = `
+insert into login_challenges (token_hash, user_id, expires_at)
+values ($1, $2, $3)
+`
+	getLoginChallengeQuery = `
+select user_id
+from login_challenges
+where token_hash = $1
+  and expires_at > now()
+`
+	deleteLoginChallengeQuery = `
+delete from login_challenges
+where token_hash = $1
+   or expires_at < now()
+`
+	// NOTIFY уходит только при реальной вставке и доставляется после коммита
+	addOrderQuery = `
+with inserted as (
+    insert into user_orders (order_id, user_id)
+        values ($1, $2)
+        on conflict do nothing
+        returning order_id, uploaded_at),
+     history as (
+         insert into order_status_history (order_id, status, changed_at)
+             select order_id, 'NEW', uploaded_at
+             from inserted)
+select pg_notify('` + newOrdersChannel + `', order_id)
+from inserted;
 `
 	selectOrdersUserQuery = `
 select user_id
@@ -80,11 +284,84 @@ select order_id, status, accrual, uploaded_at
 from user_orders
 where user_id = $1
 order by uploaded_at desc
+`
+	getUserOrderQuery = `
+select order_id, status, accrual, uploaded_at
+from user_orders
+where order_id = $1
+  and user_id = $2
+`
+	getOrderStatusHistoryQuery = `
+select status, changed_at
+from order_status_history
+where order_id = $1
+order by changed_at, id
 `
 	getUserBalanceQuery = `
-select current_balance, withdrawn
+select coalesce(sum(amount), 0)                                          as current_balance,
+       coalesce(-sum(amount) filter ( where kind = 'withdrawal' ), 0) as withdrawn
+from ledger_entries
+where user_id = $1
+  and account = 'user'
+`
+	getBalanceHistoryQuery = `
+select l.id,
+       l.kind,
+       l.amount,
+       coalesce(l.order_id, '') as order_id,
+       coalesce(a.reason, '')   as reason,
+       coalesce(a.note, '')     as note,
+       l.created_at
+from ledger_entries l
+         left join balance_adjustments a on a.ledger_tx_id = l.tx_id
+where l.user_id = $1
+  and l.account = 'user'
+order by l.created_at desc, l.id desc
+`
+	adjustBalanceQuery = `
+insert into user_balance (user_id, current_balance)
+values ($1, $2)
+on conflict (user_id) do update
+    set current_balance = user_balance.current_balance + EXCLUDED.current_balance
+returning current_balance
+`
+	addBalanceAdjustmentQuery = `
+insert into balance_adjustments (ledger_tx_id, user_id, actor_id, amount, reason, note)
+values ($1, $2, $3, $4, $5, $6)
+returning id, created_at
+`
+	getBalanceAdjustmentsQuery = `
+select id, user_id, actor_id, amount, reason, note, created_at
+from balance_adjustments
+where user_id = $1
+order by created_at desc, id desc
+`
+	nextLedgerTxQuery = `
+select nextval('ledger_tx_seq')
+`
+	insertLedgerEntryQuery = `
+insert into ledger_entries
+    (tx_id, account, user_id, kind, amount, order_id)
+values ($1, $2, $3, $4, $5, nullif($6, ''))
+`
+	getOrderAccruedQuery = `
+select coalesce(sum(amount), 0)
+from ledger_entries
+where order_id = $1
+  and account = 'user'
+  and kind in ('accrual', 'reversal')
+`
+	lockUserBalanceQuery = `
+select current_balance
 from user_balance
 where user_id = $1
+    for update
+`
+	getUserLedgerBalanceQuery = `
+select coalesce(sum(amount), 0)
+from ledger_entries
+where user_id = $1
+  and account = 'user'
 `
 	decreaseBalanceQuery = `
 update user_balance
@@ -105,23 +382,120 @@ from user_withdrawals
 where user_id = $1
 order by processed_at desc
 `
-	getOrderForAccrualQuery = `
+	// SKIP LOCKED - параллельные воркеры не ждут друг друга и не берут одни и те же заказы.
+	// next_attempt_at сдвигается на время до следующей проверки, если accrual ответит, что расчет еще не готов
+	claimOrdersForAccrualQuery = `
 update user_orders
-set updated_at = now() + interval '3 seconds'
+set lease_owner      = $1,
+    lease_expires_at = now() + make_interval(secs => $3),
+    next_attempt_at  = now() + interval '3 seconds'
 where order_id in (select order_id
                    from user_orders
-                   where updated_at < now()
+                   where next_attempt_at <= now()
                      and status in ('NEW', 'PROCESSING', 'REGISTERED')
-                   order by updated_at
-                   limit 1)
-returning order_id
+                     and dead_lettered_at is null
+                     and (lease_expires_at is null or lease_expires_at < now())
+                     and not exists (select 1 from accrual_backoff where paused_until > now())
+                   order by next_attempt_at
+                   limit $2 for update skip locked)
+returning order_id, attempts
+`
+	// неудачная попытка: следующая через retry секунд или dead letter
+	failOrderAttemptQuery = `
+update user_orders
+set attempts         = attempts + 1,
+    last_error       = $3,
+    next_attempt_at  = now() + make_interval(secs => $4),
+    dead_lettered_at = case when $5::boolean then now() end,
+    lease_owner      = null,
+    lease_expires_at = null
+where order_id = $1
+  and lease_owner = $2
+`
+	getDeadLetterOrdersQuery = `
+select order_id, user_id, status, attempts, coalesce(last_error, '') as last_error, dead_lettered_at, uploaded_at
+from user_orders
+where dead_lettered_at is not null
+order by dead_lettered_at desc
+`
+	// перезапуск будит воркеры так же, как новый заказ
+	requeueOrderQuery = `
+with requeued as (
+    update user_orders
+        set attempts = 0,
+            last_error = null,
+            dead_lettered_at = null,
+            next_attempt_at = now()
+        where order_id = $1
+            and dead_lettered_at is not null
+        returning order_id)
+select pg_notify('` + newOrdersChannel + `', order_id)
+from requeued
+`
+	extendOrderLeasesQuery = `
+update user_orders
+set lease_expires_at = now() + make_interval(secs => $2)
+where lease_owner = $1
 `
+	releaseOrderLeasesQuery = `
+update user_orders
+set lease_owner      = null,
+    lease_expires_at = null
+where lease_owner = $1
+`
+	getOrderStatusQuery = `
+select status
+from user_orders
+where order_id = $1
+`
+	// статус меняет только владелец аренды, аренда при этом снимается. status = $5 - статус,
+	// для которого сервис проверил переход: если он успел смениться, ответ устарел
 	setOrderStatusQuery = `
 update user_orders
-set status = $2,
-    accrual = $3
+set status           = $2,
+    accrual          = $3,
+    attempts         = 0,
+    last_error       = null,
+    lease_owner      = null,
+    lease_expires_at = null
 where order_id = $1
-returning user_id
+  and lease_owner = $4
+  and status = $5
+returning user_id, uploaded_at
+`
+	addOrderStatusHistoryQuery = `
+insert into order_status_history (order_id, status)
+values ($1, $2)
+`
+	// считается по часам базы: часы инстансов могут расходиться с ней
+	getNextOrderDelayQuery = `
+select extract(epoch from min(greatest(o.next_attempt_at, o.lease_expires_at, b.paused_until)) - now())
+from user_orders o
+         left join accrual_backoff b on true
+where o.status in ('NEW', 'PROCESSING', 'REGISTERED')
+  and o.dead_lettered_at is null
+`
+	// пауза только продлевается: параллельный 429 с меньшим Retry-After ее не сократит
+	setAccrualBackoffQuery = `
+insert into accrual_backoff (id, paused_until)
+values (1, now() + make_interval(secs => $1))
+on conflict (id) do update
+    set paused_until = greatest(accrual_backoff.paused_until, EXCLUDED.paused_until)
+`
+	listenNewOrdersQuery = `listen ` + newOrdersChannel
+	// очередь, которую воркеры могут взять прямо сейчас: без dead letter и отложенных повторов
+	countAccrualBacklogQuery = `
+select count(*)
+from user_orders
+where status in ('NEW', 'PROCESSING', 'REGISTERED')
+  and dead_lettered_at is null
+  and next_attempt_at <= now()
+`
+	countOrdersByStatusQuery = `
+select status, count(*)
+from user_orders
+where status = any ($1)
+group by status
 `
 	increaseBalanceQuery = `
 insert into user_balance
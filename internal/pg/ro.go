@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"gophermart/internal/model"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
 func (r PostgresRepository) GetAuthInfo(ctx context.Context, login string) (int64, string, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetAuthInfo")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -26,7 +30,48 @@ func (r PostgresRepository) GetAuthInfo(ctx context.Context, login string) (int6
 	return userID, pass, nil
 }
 
+func (r PostgresRepository) GetAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetAPIKeys")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getAPIKeysQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetAPIKeys-getAPIKeysQuery-err: %w", err)
+	}
+	defer rows.Close()
+
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.APIKey])
+	if err != nil {
+		return nil, fmt.Errorf("GetAPIKeys-CollectRows-err: %w", err)
+	}
+
+	return keys, nil
+}
+
+// GetLoginLock возвращает, сколько еще заблокирован вход по любому из ключей (0 - не заблокирован)
+func (r PostgresRepository) GetLoginLock(ctx context.Context, keys []string) (time.Duration, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetLoginLock")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var lock time.Duration
+	err := r.DB.QueryRow(ctx, getLoginLockQuery, keys).Scan(&lock)
+	if err != nil {
+		return 0, fmt.Errorf("GetLoginLock-Query-err: %w", err)
+	}
+
+	return lock, nil
+}
+
 func (r PostgresRepository) GetOrders(ctx context.Context, userID int64) ([]model.Order, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetOrders")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -44,7 +89,74 @@ func (r PostgresRepository) GetOrders(ctx context.Context, userID int64) ([]mode
 	return orders, nil
 }
 
+// GetOrder отдает заказ юзера. Чужой заказ не отличается от несуществующего - ErrOrderNotFound
+func (r PostgresRepository) GetOrder(ctx context.Context, userID int64, orderID string) (model.Order, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetOrder")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getUserOrderQuery, orderID, userID)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("GetOrder-getUserOrderQuery-err: %w", err)
+	}
+
+	order, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByNameLax[model.Order])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Order{}, model.ErrOrderNotFound
+		}
+		return model.Order{}, fmt.Errorf("GetOrder-CollectExactlyOneRow-err: %w", err)
+	}
+
+	return order, nil
+}
+
+func (r PostgresRepository) GetOrderStatusHistory(ctx context.Context, orderID string) ([]model.OrderStatusChange, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetOrderStatusHistory")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getOrderStatusHistoryQuery, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrderStatusHistory-Query-err: %w", err)
+	}
+
+	history, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.OrderStatusChange])
+	if err != nil {
+		return nil, fmt.Errorf("GetOrderStatusHistory-CollectRows-err: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetOrderStatus отдает текущий статус заказа для проверки перехода
+func (r PostgresRepository) GetOrderStatus(ctx context.Context, orderID string) (string, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetOrderStatus")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var status string
+	err := r.DB.QueryRow(ctx, getOrderStatusQuery, orderID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", model.ErrOrderNotFound
+		}
+		return "", fmt.Errorf("GetOrderStatus-Query-err: %w", err)
+	}
+
+	return status, nil
+}
+
 func (r PostgresRepository) GetBalance(ctx context.Context, userID int64) (model.Balance, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetBalance")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -55,14 +167,59 @@ func (r PostgresRepository) GetBalance(ctx context.Context, userID int64) (model
 	defer rows.Close()
 
 	balance, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[model.Balance])
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // если запись по юзеру не найдена, то вместо ошибки вернем нулевой баланс
+	if err != nil { // баланс считается агрегатом по журналу, поэтому строка есть всегда, даже у юзера без проводок
 		return model.Balance{}, fmt.Errorf("GetBalance-CollectRows-err: %w", err)
 	}
 
 	return balance, nil
 }
 
+func (r PostgresRepository) GetBalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetBalanceHistory")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getBalanceHistoryQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceHistory-getBalanceHistoryQuery-err: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[model.LedgerEntry])
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceHistory-CollectRows-err: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r PostgresRepository) GetBalanceAdjustments(ctx context.Context, userID int64) ([]model.BalanceAdjustment, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetBalanceAdjustments")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getBalanceAdjustmentsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceAdjustments-getBalanceAdjustmentsQuery-err: %w", err)
+	}
+	defer rows.Close()
+
+	adjustments, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.BalanceAdjustment])
+	if err != nil {
+		return nil, fmt.Errorf("GetBalanceAdjustments-CollectRows-err: %w", err)
+	}
+
+	return adjustments, nil
+}
+
 func (r PostgresRepository) GetWithdrawals(ctx context.Context, userID int64) ([]model.Withdraw, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetWithdrawals")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -80,18 +237,230 @@ func (r PostgresRepository) GetWithdrawals(ctx context.Context, userID int64) ([
 	return withdrawals, nil
 }
 
-func (r PostgresRepository) GetOrderForAccrual(ctx context.Context) (string, error) {
+func (r PostgresRepository) GetDeadLetterOrders(ctx context.Context) ([]model.DeadLetterOrder, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetDeadLetterOrders")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, getDeadLetterOrdersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeadLetterOrders-Query-err: %w", err)
+	}
+
+	orders, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.DeadLetterOrder])
+	if err != nil {
+		return nil, fmt.Errorf("GetDeadLetterOrders-CollectRows-err: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetNextOrderDelay возвращает, через сколько ближайший заказ станет доступен ClaimOrdersForAccrual
+// (отрицательное - уже доступен). ok=false - ждущих заказов нет
+func (r PostgresRepository) GetNextOrderDelay(ctx context.Context) (delay time.Duration, ok bool, err error) {
+	ctx, span := tracer.Start(ctx, "pg.GetNextOrderDelay")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
-	var orderID string
-	err := r.DB.QueryRow(ctx, getOrderForAccrualQuery).Scan(&orderID)
+	var seconds *float64
+	err = r.DB.QueryRow(ctx, getNextOrderDelayQuery).Scan(&seconds)
+	if err != nil {
+		return 0, false, fmt.Errorf("GetNextOrderDelay-Query-err: %w", err)
+	}
+
+	if seconds == nil {
+		return 0, false, nil
+	}
+
+	return time.Duration(*seconds * float64(time.Second)), true, nil
+}
+
+// CountAccrualBacklog считает заказы, которые ждут воркеров accrual прямо сейчас, для автомасштабирования пула
+func (r PostgresRepository) CountAccrualBacklog(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "pg.CountAccrualBacklog")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var count int64
+	err := r.DB.QueryRow(ctx, countAccrualBacklogQuery).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("CountAccrualBacklog-Query-err: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountOrdersByStatus считает заказы в статусах statuses, для метрики глубины очереди
+func (r PostgresRepository) CountOrdersByStatus(ctx context.Context, statuses []string) (map[string]int64, error) {
+	ctx, span := tracer.Start(ctx, "pg.CountOrdersByStatus")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, countOrdersByStatusQuery, statuses)
+	if err != nil {
+		return nil, fmt.Errorf("CountOrdersByStatus-Query-err: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64, len(statuses))
+	for rows.Next() {
+		var (
+			status string
+			count  int64
+		)
+		if err = rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("CountOrdersByStatus-Scan-err: %w", err)
+		}
+		counts[status] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("CountOrdersByStatus-Rows-err: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (r PostgresRepository) GetLogin(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetLogin")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var login string
+	err := r.DB.QueryRow(ctx, getLoginQuery, userID).Scan(&login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", model.ErrWrongLogin
+		}
+		return "", fmt.Errorf("GetLogin-Query-err: %w", err)
+	}
+
+	return login, nil
+}
+
+// GetTOTP возвращает настройки 2FA юзера, ErrTOTPNotEnabled - если подключение даже не начиналось
+func (r PostgresRepository) GetTOTP(ctx context.Context, userID int64) (model.TOTP, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetTOTP")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var totp model.TOTP
+	err := r.DB.QueryRow(ctx, getTOTPQuery, userID).Scan(&totp.Secret, &totp.Enabled, &totp.WithdrawStepUp, &totp.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.TOTP{}, model.ErrTOTPNotEnabled
+		}
+		return model.TOTP{}, fmt.Errorf("GetTOTP-Query-err: %w", err)
+	}
+
+	return totp, nil
+}
+
+// GetLoginChallenge возвращает юзера незавершенного логина
+func (r PostgresRepository) GetLoginChallenge(ctx context.Context, tokenHash string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetLoginChallenge")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var userID int64
+	err := r.DB.QueryRow(ctx, getLoginChallengeQuery, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, model.ErrInvalidLoginChallenge
+		}
+		return 0, fmt.Errorf("GetLoginChallenge-Query-err: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (r PostgresRepository) GetPassword(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetPassword")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var pass string
+	err := r.DB.QueryRow(ctx, getPasswordQuery, userID).Scan(&pass)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", model.ErrWrongLogin
+		}
+		return "", fmt.Errorf("GetPassword-Query-err: %w", err)
+	}
+
+	return pass, nil
+}
+
+// GetTokensValidAfter возвращает время последней смены пароля или роли, нулевое - если ничего не менялось
+func (r PostgresRepository) GetTokensValidAfter(ctx context.Context, userID int64) (time.Time, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetTokensValidAfter")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var validAfter *time.Time
+	err := r.DB.QueryRow(ctx, getTokensValidAfterQuery, userID).Scan(&validAfter)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, model.ErrWrongLogin
+		}
+		return time.Time{}, fmt.Errorf("GetTokensValidAfter-Query-err: %w", err)
+	}
+
+	if validAfter == nil {
+		return time.Time{}, nil
+	}
+
+	return *validAfter, nil
+}
+
+func (r PostgresRepository) GetUser(ctx context.Context, userID int64) (model.User, error) {
+	ctx, span := tracer.Start(ctx, "pg.GetUser")
+	defer span.End()
+
+	return r.getUser(ctx, getUserQuery, userID)
+}
+
+func (r PostgresRepository) FindUserByLogin(ctx context.Context, login string) (model.User, error) {
+	ctx, span := tracer.Start(ctx, "pg.FindUserByLogin")
+	defer span.End()
+
+	return r.getUser(ctx, findUserByLoginQuery, login)
+}
+
+func (r PostgresRepository) getUser(ctx context.Context, query string, arg any) (model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, query, arg)
+	if err != nil {
+		return model.User{}, fmt.Errorf("getUser-Query-err: %w", err)
+	}
+	defer rows.Close()
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[model.User])
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", err
+			return model.User{}, model.ErrUserNotFound
 		}
-		return "", fmt.Errorf("GetOrderForAccrual-Query-err: %w", err)
+		return model.User{}, fmt.Errorf("getUser-CollectOneRow-err: %w", err)
 	}
 
-	return orderID, nil
+	return user, nil
 }
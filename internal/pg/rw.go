@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"gophermart/internal/metrics"
 	"gophermart/internal/model"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
 func (r PostgresRepository) AddAuthInfo(ctx context.Context, login, hashPass string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "pg.AddAuthInfo")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -25,7 +30,532 @@ func (r PostgresRepository) AddAuthInfo(ctx context.Context, login, hashPass str
 	return userID, nil
 }
 
+// UpdatePassword заменяет хеш oldHash на hashPass. false - пароль в базе уже другой, ничего не изменено
+func (r PostgresRepository) UpdatePassword(ctx context.Context, userID int64, oldHash, hashPass string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "pg.UpdatePassword")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, updatePasswordQuery, userID, hashPass, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("UpdatePassword-Exec-err: %w", err)
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// ChangePassword меняет пароль и отзывает все сессии юзера: refresh-токены и незавершенные сбросы пароля,
+// а access-токены отсекаются по password_changed_at
+func (r PostgresRepository) ChangePassword(ctx context.Context, userID int64, hashPass string) error {
+	ctx, span := tracer.Start(ctx, "pg.ChangePassword")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = changePasswordTx(ctx, tx, userID, hashPass)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-changePasswordTx-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-Commit-err: %w", err)
+	}
+
+	return nil
+}
+
+// SetRole меняет роль юзера. Выданные токены несут старую роль, поэтому они отзываются
+func (r PostgresRepository) SetRole(ctx context.Context, userID int64, role string) error {
+	ctx, span := tracer.Start(ctx, "pg.SetRole")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("SetRole-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, setRoleQuery, userID, role)
+	if err != nil {
+		return fmt.Errorf("SetRole-setRoleQuery-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrUserNotFound
+	}
+
+	_, err = tx.Exec(ctx, revokeUserRefreshTokensQuery, userID)
+	if err != nil {
+		return fmt.Errorf("SetRole-revokeUserRefreshTokensQuery-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("SetRole-Commit-err: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) AddPasswordResetToken(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	ctx, span := tracer.Start(ctx, "pg.AddPasswordResetToken")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, addPasswordResetTokenQuery, tokenHash, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("AddPasswordResetToken-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword гасит токен сброса и меняет по нему пароль в одной транзакции
+func (r PostgresRepository) ResetPassword(ctx context.Context, tokenHash, hashPass string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "pg.ResetPassword")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ResetPassword-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, usePasswordResetTokenQuery, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, model.ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("ResetPassword-usePasswordResetTokenQuery-err: %w", err)
+	}
+
+	err = changePasswordTx(ctx, tx, userID, hashPass)
+	if err != nil {
+		return 0, fmt.Errorf("ResetPassword-changePasswordTx-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ResetPassword-Commit-err: %w", err)
+	}
+
+	return userID, nil
+}
+
+func changePasswordTx(ctx context.Context, tx pgx.Tx, userID int64, hashPass string) error {
+	commandTag, err := tx.Exec(ctx, changePasswordQuery, userID, hashPass)
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrWrongLogin
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(revokeUserRefreshTokensQuery, userID)
+	batch.Queue(invalidatePasswordResetTokensQuery, userID)
+
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+func (r PostgresRepository) AddRefreshToken(ctx context.Context, token model.RefreshToken) error {
+	ctx, span := tracer.Start(ctx, "pg.AddRefreshToken")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, addRefreshTokenQuery, token.Hash, token.FamilyID, token.UserID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("AddRefreshToken-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken помечает токен oldHash использованным и сохраняет вместо него newToken из того же семейства.
+// Повторное предъявление уже использованного токена означает его утечку - тогда отзывается все семейство.
+func (r PostgresRepository) RotateRefreshToken(ctx context.Context, oldHash string, newToken model.RefreshToken) (model.RefreshToken, error) {
+	ctx, span := tracer.Start(ctx, "pg.RotateRefreshToken")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var expired, used, revoked bool
+	err = tx.QueryRow(ctx, getRefreshTokenForUpdateQuery, oldHash).Scan(&newToken.FamilyID, &newToken.UserID, &expired, &used, &revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.RefreshToken{}, model.ErrInvalidRefreshToken
+		}
+		return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-getRefreshTokenForUpdateQuery-err: %w", err)
+	}
+
+	if revoked || expired {
+		return model.RefreshToken{}, model.ErrInvalidRefreshToken
+	}
+
+	if used {
+		_, err = tx.Exec(ctx, revokeRefreshTokenFamilyQuery, newToken.FamilyID)
+		if err != nil {
+			return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-revokeRefreshTokenFamilyQuery-err: %w", err)
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-Commit-err: %w", err)
+		}
+
+		return model.RefreshToken{}, model.ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(ctx, useRefreshTokenQuery, oldHash)
+	if err != nil {
+		return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-useRefreshTokenQuery-err: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, addRefreshTokenQuery, newToken.Hash, newToken.FamilyID, newToken.UserID, newToken.ExpiresAt)
+	if err != nil {
+		return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-addRefreshTokenQuery-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return model.RefreshToken{}, fmt.Errorf("RotateRefreshToken-Commit-err: %w", err)
+	}
+
+	return newToken, nil
+}
+
+func (r PostgresRepository) RevokeRefreshTokenFamily(ctx context.Context, tokenHash string) error {
+	ctx, span := tracer.Start(ctx, "pg.RevokeRefreshTokenFamily")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, revokeRefreshTokenFamilyByTokenQuery, tokenHash)
+	if err != nil {
+		return fmt.Errorf("RevokeRefreshTokenFamily-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) AddAPIKey(ctx context.Context, userID int64, key model.APIKey, keyHash string) (model.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "pg.AddAPIKey")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	err := r.DB.QueryRow(ctx, addAPIKeyQuery, userID, key.Name, key.Prefix, keyHash, key.Scopes).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("AddAPIKey-Query-err: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r PostgresRepository) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	ctx, span := tracer.Start(ctx, "pg.RevokeAPIKey")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, revokeAPIKeyQuery, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("RevokeAPIKey-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// UseAPIKey находит действующий ключ по хешу и отмечает время его использования
+func (r PostgresRepository) UseAPIKey(ctx context.Context, keyHash string) (int64, []string, error) {
+	ctx, span := tracer.Start(ctx, "pg.UseAPIKey")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var userID int64
+	var scopes []string
+	err := r.DB.QueryRow(ctx, useAPIKeyQuery, keyHash).Scan(&userID, &scopes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, model.ErrInvalidAPIKey
+		}
+		return 0, nil, fmt.Errorf("UseAPIKey-Query-err: %w", err)
+	}
+
+	return userID, scopes, nil
+}
+
+// AddLoginFailure увеличивает счетчик неудачных попыток. Если последняя неудача была раньше window, счет начинается заново
+func (r PostgresRepository) AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	ctx, span := tracer.Start(ctx, "pg.AddLoginFailure")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	var failures int
+	err := r.DB.QueryRow(ctx, addLoginFailureQuery, key, window).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("AddLoginFailure-Query-err: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (r PostgresRepository) SetLoginLock(ctx context.Context, key string, lock time.Duration) error {
+	ctx, span := tracer.Start(ctx, "pg.SetLoginLock")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, setLoginLockQuery, key, lock)
+	if err != nil {
+		return fmt.Errorf("SetLoginLock-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	ctx, span := tracer.Start(ctx, "pg.ResetLoginFailures")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, resetLoginFailuresQuery, key)
+	if err != nil {
+		return fmt.Errorf("ResetLoginFailures-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// SetTOTPSecret начинает (или начинает заново) подключение 2FA. Подключенную 2FA перезаписать нельзя
+func (r PostgresRepository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	ctx, span := tracer.Start(ctx, "pg.SetTOTPSecret")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	err := r.DB.QueryRow(ctx, setTOTPSecretQuery, userID, secret).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrTOTPAlreadyEnabled
+		}
+		return fmt.Errorf("SetTOTPSecret-Query-err: %w", err)
+	}
+
+	return nil
+}
+
+// EnableTOTP подтверждает подключение 2FA первым принятым кодом и сохраняет коды восстановления
+func (r PostgresRepository) EnableTOTP(ctx context.Context, userID, step int64, recoveryCodeHashes []string) error {
+	ctx, span := tracer.Start(ctx, "pg.EnableTOTP")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("EnableTOTP-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, enableTOTPQuery, userID, step)
+	if err != nil {
+		return fmt.Errorf("EnableTOTP-enableTOTPQuery-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrTOTPSetupNotFound
+	}
+
+	err = replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("EnableTOTP-replaceRecoveryCodesTx-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("EnableTOTP-Commit-err: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep запоминает интервал принятого кода. Код из уже использованного интервала - повтор, он отклоняется
+func (r PostgresRepository) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	ctx, span := tracer.Start(ctx, "pg.UseTOTPStep")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, useTOTPStepQuery, userID, step)
+	if err != nil {
+		return fmt.Errorf("UseTOTPStep-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrWrongTOTPCode
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	ctx, span := tracer.Start(ctx, "pg.UseRecoveryCode")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, useRecoveryCodeQuery, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("UseRecoveryCode-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrWrongTOTPCode
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления юзера новыми
+func (r PostgresRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	ctx, span := tracer.Start(ctx, "pg.ReplaceRecoveryCodes")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = replaceRecoveryCodesTx(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes-replaceRecoveryCodesTx-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes-Commit-err: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodesTx(ctx context.Context, tx pgx.Tx, userID int64, codeHashes []string) error {
+	batch := &pgx.Batch{}
+	batch.Queue(deleteRecoveryCodesQuery, userID)
+	for _, hash := range codeHashes {
+		batch.Queue(addRecoveryCodeQuery, userID, hash)
+	}
+
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+func (r PostgresRepository) SetWithdrawStepUp(ctx context.Context, userID int64, required bool) error {
+	ctx, span := tracer.Start(ctx, "pg.SetWithdrawStepUp")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, setWithdrawStepUpQuery, userID, required)
+	if err != nil {
+		return fmt.Errorf("SetWithdrawStepUp-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrTOTPNotEnabled
+	}
+
+	return nil
+}
+
+func (r PostgresRepository) AddLoginChallenge(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	ctx, span := tracer.Start(ctx, "pg.AddLoginChallenge")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, addLoginChallengeQuery, tokenHash, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("AddLoginChallenge-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLoginChallenge удаляет завершенный логин, заодно подчищая протухшие
+func (r PostgresRepository) DeleteLoginChallenge(ctx context.Context, tokenHash string) error {
+	ctx, span := tracer.Start(ctx, "pg.DeleteLoginChallenge")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, deleteLoginChallengeQuery, tokenHash)
+	if err != nil {
+		return fmt.Errorf("DeleteLoginChallenge-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
 func (r PostgresRepository) AddOrder(ctx context.Context, orderID string, userID int64) error {
+	ctx, span := tracer.Start(ctx, "pg.AddOrder")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -52,6 +582,9 @@ func (r PostgresRepository) AddOrder(ctx context.Context, orderID string, userID
 }
 
 func (r PostgresRepository) Withdraw(ctx context.Context, withdraw model.Withdraw) error {
+	ctx, span := tracer.Start(ctx, "pg.Withdraw")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -62,19 +595,20 @@ func (r PostgresRepository) Withdraw(ctx context.Context, withdraw model.Withdra
 	}
 	defer tx.Rollback(ctx)
 
-	var newBalance float64
-	err = tx.QueryRow(ctx, decreaseBalanceQuery, withdraw.UserID, withdraw.Sum).Scan(&newBalance)
+	balance, err := lockBalance(ctx, tx, withdraw.UserID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return model.ErrNotEnoughMoney
-		}
-		return fmt.Errorf("Withdraw-decreaseBalanceQuery-err: %w", err)
+		return fmt.Errorf("Withdraw-lockBalance-err: %w", err)
 	}
 
-	if newBalance < 0 {
+	if balance.Cmp(withdraw.Sum) < 0 {
 		return model.ErrNotEnoughMoney
 	}
 
+	_, err = tx.Exec(ctx, decreaseBalanceQuery, withdraw.UserID, withdraw.Sum)
+	if err != nil {
+		return fmt.Errorf("Withdraw-decreaseBalanceQuery-err: %w", err)
+	}
+
 	commandTag, err := tx.Exec(ctx, newWithdrawQuery, withdraw.UserID, withdraw.OrderID, withdraw.Sum)
 	if err != nil {
 		return fmt.Errorf("Withdraw-newWithdrawQuery-err: %w", err)
@@ -84,6 +618,11 @@ func (r PostgresRepository) Withdraw(ctx context.Context, withdraw model.Withdra
 		return model.ErrOrderAlreadyUploaded
 	}
 
+	_, err = postLedgerTx(ctx, tx, model.LedgerKindWithdrawal, withdraw.UserID, withdraw.OrderID, withdraw.Sum.Neg(), ledgerAccountWithdrawal)
+	if err != nil {
+		return fmt.Errorf("Withdraw-postLedgerTx-err: %w", err)
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return fmt.Errorf("Withdraw-Commit-err: %w", err)
@@ -92,7 +631,169 @@ func (r PostgresRepository) Withdraw(ctx context.Context, withdraw model.Withdra
 	return nil
 }
 
-func (r PostgresRepository) SetAccrual(ctx context.Context, accrual model.Accrual) error {
+// AdjustBalance проводит ручную корректировку баланса и сохраняет запись аудита в одной транзакции.
+// Списание, после которого баланс ушел бы в минус, отклоняется
+func (r PostgresRepository) AdjustBalance(ctx context.Context, adj model.BalanceAdjustment) (model.BalanceAdjustment, error) {
+	ctx, span := tracer.Start(ctx, "pg.AdjustBalance")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-BeginTx-err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	balance, err := lockBalance(ctx, tx, adj.UserID)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-lockBalance-err: %w", err)
+	}
+
+	if balance.Add(adj.Amount).IsNegative() {
+		return model.BalanceAdjustment{}, model.ErrNotEnoughMoney
+	}
+
+	_, err = tx.Exec(ctx, adjustBalanceQuery, adj.UserID, adj.Amount)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-adjustBalanceQuery-err: %w", err)
+	}
+
+	txID, err := postLedgerTx(ctx, tx, model.LedgerKindAdjustment, adj.UserID, "", adj.Amount, ledgerAccountAdjustment)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-postLedgerTx-err: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, addBalanceAdjustmentQuery, txID, adj.UserID, adj.ActorID, adj.Amount, adj.Reason, adj.Note).Scan(&adj.ID, &adj.CreatedAt)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-addBalanceAdjustmentQuery-err: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-Commit-err: %w", err)
+	}
+
+	return adj, nil
+}
+
+// ClaimOrdersForAccrual берет в аренду до limit заказов, которые пора проверить в accrual
+func (r PostgresRepository) ClaimOrdersForAccrual(ctx context.Context, owner string, limit int, leaseTTL time.Duration) ([]model.AccrualJob, error) {
+	ctx, span := tracer.Start(ctx, "pg.ClaimOrdersForAccrual")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	rows, err := r.DB.Query(ctx, claimOrdersForAccrualQuery, owner, limit, leaseTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOrdersForAccrual-Query-err: %w", err)
+	}
+
+	jobs, err := pgx.CollectRows(rows, pgx.RowToStructByName[model.AccrualJob])
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOrdersForAccrual-CollectRows-err: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// FailOrderAttempt записывает неудачную попытку и снимает аренду: заказ вернется в очередь через retryIn
+// или, если deadLetter, уйдет в dead letter
+func (r PostgresRepository) FailOrderAttempt(ctx context.Context, orderID, owner, lastErr string, retryIn time.Duration, deadLetter bool) error {
+	ctx, span := tracer.Start(ctx, "pg.FailOrderAttempt")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, failOrderAttemptQuery, orderID, owner, lastErr, retryIn.Seconds(), deadLetter)
+	if err != nil {
+		return fmt.Errorf("FailOrderAttempt-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrOrderLeaseLost
+	}
+
+	return nil
+}
+
+// RequeueOrder возвращает заказ из dead letter в очередь с обнуленным счетчиком попыток
+func (r PostgresRepository) RequeueOrder(ctx context.Context, orderID string) error {
+	ctx, span := tracer.Start(ctx, "pg.RequeueOrder")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	commandTag, err := r.DB.Exec(ctx, requeueOrderQuery, orderID)
+	if err != nil {
+		return fmt.Errorf("RequeueOrder-Exec-err: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return model.ErrOrderNotDeadLettered
+	}
+
+	return nil
+}
+
+// ExtendOrderLeases продлевает все аренды owner, пока он ждет ответа accrual
+func (r PostgresRepository) ExtendOrderLeases(ctx context.Context, owner string, leaseTTL time.Duration) error {
+	ctx, span := tracer.Start(ctx, "pg.ExtendOrderLeases")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, extendOrderLeasesQuery, owner, leaseTTL.Seconds())
+	if err != nil {
+		return fmt.Errorf("ExtendOrderLeases-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseOrderLeases снимает оставшиеся аренды owner, например если воркер не успел обработать весь батч
+func (r PostgresRepository) ReleaseOrderLeases(ctx context.Context, owner string) error {
+	ctx, span := tracer.Start(ctx, "pg.ReleaseOrderLeases")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, releaseOrderLeasesQuery, owner)
+	if err != nil {
+		return fmt.Errorf("ReleaseOrderLeases-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// SetAccrualBackoff останавливает запросы к accrual на всех инстансах на d: ClaimOrdersForAccrual до ее конца ничего не вернет
+func (r PostgresRepository) SetAccrualBackoff(ctx context.Context, d time.Duration) error {
+	ctx, span := tracer.Start(ctx, "pg.SetAccrualBackoff")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
+	defer cancel()
+
+	_, err := r.DB.Exec(ctx, setAccrualBackoffQuery, d.Seconds())
+	if err != nil {
+		return fmt.Errorf("SetAccrualBackoff-Exec-err: %w", err)
+	}
+
+	return nil
+}
+
+// SetAccrual сохраняет ответ accrual, пишет смену статуса from -> accrual.Status в историю и снимает аренду.
+// Если аренда уже у другого воркера или статус успел смениться - ErrOrderLeaseLost
+func (r PostgresRepository) SetAccrual(ctx context.Context, accrual model.Accrual, owner, from string) error {
+	ctx, span := tracer.Start(ctx, "pg.SetAccrual")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, r.DBTimeout)
 	defer cancel()
 
@@ -103,14 +804,33 @@ func (r PostgresRepository) SetAccrual(ctx context.Context, accrual model.Accrua
 	}
 	defer tx.Rollback(ctx)
 
-	var userID string
-	err = tx.QueryRow(ctx, setOrderStatusQuery, accrual.Order, accrual.Status, accrual.Accrual).Scan(&userID)
+	var (
+		userID     int64
+		uploadedAt time.Time
+	)
+	err = tx.QueryRow(ctx, setOrderStatusQuery, accrual.Order, accrual.Status, accrual.Accrual, owner, from).Scan(&userID, &uploadedAt)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrOrderLeaseLost
+		}
 		return fmt.Errorf("SetAccrual-setOrderStatusQuery-err: %w", err)
 	}
 
-	if accrual.Accrual != 0 {
-		_, err = tx.Exec(ctx, increaseBalanceQuery, userID, accrual.Accrual)
+	if accrual.Status != from {
+		_, err = tx.Exec(ctx, addOrderStatusHistoryQuery, accrual.Order, accrual.Status)
+		if err != nil {
+			return fmt.Errorf("SetAccrual-addOrderStatusHistoryQuery-err: %w", err)
+		}
+	}
+
+	delta, err := postAccrual(ctx, tx, userID, accrual.Order, accrual.Accrual)
+	if err != nil {
+		return fmt.Errorf("SetAccrual-postAccrual-err: %w", err)
+	}
+
+	// user_balance - проекция журнала, по ее строке сериализуются списания
+	if !delta.IsZero() {
+		_, err = tx.Exec(ctx, increaseBalanceQuery, userID, delta)
 		if err != nil {
 			return fmt.Errorf("SetAccrual-increaseBalanceQuery-err: %w", err)
 		}
@@ -121,5 +841,9 @@ func (r PostgresRepository) SetAccrual(ctx context.Context, accrual model.Accrua
 		return fmt.Errorf("SetAccrual-Commit-err: %w", err)
 	}
 
+	if accrual.Status != from && model.IsFinalOrderStatus(accrual.Status) {
+		metrics.ObserveOrderFinal(accrual.Status, uploadedAt)
+	}
+
 	return nil
 }
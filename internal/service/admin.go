@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+func (s service) GetUser(ctx context.Context, userID int64) (model.User, error) {
+	ctx, span := tracer.Start(ctx, "service.GetUser")
+	defer span.End()
+
+	return s.gmRepo.GetUser(ctx, userID)
+}
+
+func (s service) FindUser(ctx context.Context, login string) (model.User, error) {
+	ctx, span := tracer.Start(ctx, "service.FindUser")
+	defer span.End()
+
+	return s.gmRepo.FindUserByLogin(ctx, login)
+}
+
+// GetUserRole возвращает роль, которая попадет в выдаваемый юзеру токен
+func (s service) GetUserRole(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracer.Start(ctx, "service.GetUserRole")
+	defer span.End()
+
+	user, err := s.gmRepo.GetUser(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("GetUserRole-GetUser-err: %w", err)
+	}
+
+	return user.Role, nil
+}
+
+// SetUserRole меняет роль юзера. Все его токены отзываются, новая роль действует со следующего логина
+func (s service) SetUserRole(ctx context.Context, userID int64, role string) error {
+	ctx, span := tracer.Start(ctx, "service.SetUserRole")
+	defer span.End()
+
+	if !slices.Contains(model.Roles, role) {
+		return fmt.Errorf("%w: %q", model.ErrUnknownRole, role)
+	}
+
+	if err := s.gmRepo.SetRole(ctx, userID, role); err != nil {
+		return fmt.Errorf("SetUserRole-SetRole-err: %w", err)
+	}
+
+	return nil
+}
+
+// AdjustBalance вручную начисляет (amount > 0) или списывает (amount < 0) баллы юзеру.
+// Причина и заметка обязательны, actorID попадает в аудит. Свой баланс сотрудник править не может
+func (s service) AdjustBalance(ctx context.Context, actorID, userID int64, req model.BalanceAdjustmentRequest) (model.BalanceAdjustment, error) {
+	ctx, span := tracer.Start(ctx, "service.AdjustBalance")
+	defer span.End()
+
+	if actorID == userID {
+		return model.BalanceAdjustment{}, model.ErrSelfAdjustment
+	}
+
+	if req.Amount.IsZero() {
+		return model.BalanceAdjustment{}, model.ErrZeroAdjustment
+	}
+
+	if !slices.Contains(model.AdjustmentReasons, req.Reason) {
+		return model.BalanceAdjustment{}, fmt.Errorf("%w: %q", model.ErrUnknownAdjustmentReason, req.Reason)
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if note == "" {
+		return model.BalanceAdjustment{}, model.ErrEmptyAdjustmentNote
+	}
+
+	adj, err := s.gmRepo.AdjustBalance(ctx, model.BalanceAdjustment{
+		UserID:  userID,
+		ActorID: actorID,
+		Amount:  req.Amount,
+		Reason:  req.Reason,
+		Note:    note,
+	})
+	if err != nil {
+		return model.BalanceAdjustment{}, fmt.Errorf("AdjustBalance-AdjustBalance-err: %w", err)
+	}
+
+	logger.Log.Info("balance adjusted", zap.Int64("user_id", userID), zap.Int64("actor_id", actorID),
+		zap.String("amount", adj.Amount.String()), zap.String("reason", adj.Reason))
+
+	return adj, nil
+}
+
+func (s service) GetBalanceAdjustments(ctx context.Context, userID int64) ([]model.BalanceAdjustment, error) {
+	ctx, span := tracer.Start(ctx, "service.GetBalanceAdjustments")
+	defer span.End()
+
+	return s.gmRepo.GetBalanceAdjustments(ctx, userID)
+}
+
+func (s service) GetDeadLetterOrders(ctx context.Context) ([]model.DeadLetterOrder, error) {
+	ctx, span := tracer.Start(ctx, "service.GetDeadLetterOrders")
+	defer span.End()
+
+	return s.gmRepo.GetDeadLetterOrders(ctx)
+}
+
+// RequeueOrder возвращает заказ из dead letter в очередь accrual, actorID попадает в лог
+func (s service) RequeueOrder(ctx context.Context, actorID int64, orderID string) error {
+	ctx, span := tracer.Start(ctx, "service.RequeueOrder")
+	defer span.End()
+
+	if err := s.gmRepo.RequeueOrder(ctx, orderID); err != nil {
+		return fmt.Errorf("RequeueOrder-RequeueOrder-err: %w", err)
+	}
+
+	logger.Log.Info("order requeued", zap.String("order_id", orderID), zap.Int64("actor_id", actorID))
+
+	return nil
+}
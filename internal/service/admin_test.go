@@ -0,0 +1,21 @@
+package service
+
+import (
+	"context"
+	"gophermart/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdjustBalanceSelf(t *testing.T) {
+	// репозиторий не нужен: запрос отклоняется до обращения к базе
+	s := service{}
+
+	_, err := s.AdjustBalance(context.Background(), 7, 7, model.BalanceAdjustmentRequest{
+		Amount: 10000,
+		Reason: model.AdjustmentReasonGoodwill,
+		Note:   "bonus",
+	})
+	assert.ErrorIs(t, err, model.ErrSelfAdjustment)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/crypto"
+	"gophermart/internal/model"
+	"slices"
+)
+
+// CreateAPIKey создает ключ с заданными scope. Сам ключ возвращается только здесь, в базе лежит его хеш
+func (s service) CreateAPIKey(ctx context.Context, userID int64, req model.APIKeyRequest) (model.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "service.CreateAPIKey")
+	defer span.End()
+
+	if len(req.Scopes) == 0 {
+		return model.APIKey{}, fmt.Errorf("CreateAPIKey: %w: no scopes", model.ErrUnknownScope)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(model.Scopes, scope) {
+			return model.APIKey{}, fmt.Errorf("CreateAPIKey: %w: %q", model.ErrUnknownScope, scope)
+		}
+	}
+
+	secret, _, err := crypto.NewToken()
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("CreateAPIKey-NewToken-err: %w", err)
+	}
+	key := model.APIKeyPrefix + secret
+
+	apiKey, err := s.gmRepo.AddAPIKey(ctx, userID, model.APIKey{
+		Name:   req.Name,
+		Prefix: key[:len(model.APIKeyPrefix)+6],
+		Scopes: req.Scopes,
+	}, crypto.HashToken(key))
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("CreateAPIKey-AddAPIKey-err: %w", err)
+	}
+
+	apiKey.Key = key
+	return apiKey, nil
+}
+
+func (s service) GetAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "service.GetAPIKeys")
+	defer span.End()
+
+	return s.gmRepo.GetAPIKeys(ctx, userID)
+}
+
+func (s service) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	ctx, span := tracer.Start(ctx, "service.RevokeAPIKey")
+	defer span.End()
+
+	return s.gmRepo.RevokeAPIKey(ctx, userID, keyID)
+}
+
+// AuthenticateAPIKey возвращает владельца ключа и его scope
+func (s service) AuthenticateAPIKey(ctx context.Context, key string) (int64, []string, error) {
+	ctx, span := tracer.Start(ctx, "service.AuthenticateAPIKey")
+	defer span.End()
+
+	return s.gmRepo.UseAPIKey(ctx, crypto.HashToken(key))
+}
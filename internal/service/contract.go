@@ -3,16 +3,67 @@ package service
 import (
 	"context"
 	"gophermart/internal/model"
+	"time"
 )
 
 type gophermartRepo interface {
 	AddAuthInfo(ctx context.Context, login, hashPass string) (int64, error)
 	GetAuthInfo(ctx context.Context, login string) (int64, string, error)
+	UpdatePassword(ctx context.Context, userID int64, oldHash, hashPass string) (bool, error)
+	GetPassword(ctx context.Context, userID int64) (string, error)
+	GetTokensValidAfter(ctx context.Context, userID int64) (time.Time, error)
+	ChangePassword(ctx context.Context, userID int64, hashPass string) error
+	GetUser(ctx context.Context, userID int64) (model.User, error)
+	FindUserByLogin(ctx context.Context, login string) (model.User, error)
+	SetRole(ctx context.Context, userID int64, role string) error
+	AddPasswordResetToken(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash, hashPass string) (int64, error)
+	GetLoginLock(ctx context.Context, keys []string) (time.Duration, error)
+	AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	SetLoginLock(ctx context.Context, key string, lock time.Duration) error
+	ResetLoginFailures(ctx context.Context, key string) error
+	GetLogin(ctx context.Context, userID int64) (string, error)
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+	GetTOTP(ctx context.Context, userID int64) (model.TOTP, error)
+	EnableTOTP(ctx context.Context, userID, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	SetWithdrawStepUp(ctx context.Context, userID int64, required bool) error
+	AddLoginChallenge(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (int64, error)
+	DeleteLoginChallenge(ctx context.Context, tokenHash string) error
+	AddRefreshToken(ctx context.Context, token model.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, oldHash string, newToken model.RefreshToken) (model.RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, tokenHash string) error
+	AddAPIKey(ctx context.Context, userID int64, key model.APIKey, keyHash string) (model.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID int64) error
+	UseAPIKey(ctx context.Context, keyHash string) (int64, []string, error)
 	AddOrder(ctx context.Context, orderID string, userID int64) error
 	GetOrders(ctx context.Context, userID int64) ([]model.Order, error)
+	GetOrder(ctx context.Context, userID int64, orderID string) (model.Order, error)
+	GetOrderStatus(ctx context.Context, orderID string) (string, error)
+	GetOrderStatusHistory(ctx context.Context, orderID string) ([]model.OrderStatusChange, error)
 	GetBalance(ctx context.Context, userID int64) (model.Balance, error)
+	GetBalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error)
 	Withdraw(ctx context.Context, withdraw model.Withdraw) error
+	AdjustBalance(ctx context.Context, adj model.BalanceAdjustment) (model.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, userID int64) ([]model.BalanceAdjustment, error)
 	GetWithdrawals(ctx context.Context, userID int64) ([]model.Withdraw, error)
-	GetOrderForAccrual(ctx context.Context) (string, error)
-	SetAccrual(ctx context.Context, accrual model.Accrual) error
+	ClaimOrdersForAccrual(ctx context.Context, owner string, limit int, leaseTTL time.Duration) ([]model.AccrualJob, error)
+	FailOrderAttempt(ctx context.Context, orderID, owner, lastErr string, retryIn time.Duration, deadLetter bool) error
+	GetDeadLetterOrders(ctx context.Context) ([]model.DeadLetterOrder, error)
+	RequeueOrder(ctx context.Context, orderID string) error
+	ExtendOrderLeases(ctx context.Context, owner string, leaseTTL time.Duration) error
+	ReleaseOrderLeases(ctx context.Context, owner string) error
+	SetAccrualBackoff(ctx context.Context, d time.Duration) error
+	GetNextOrderDelay(ctx context.Context) (time.Duration, bool, error)
+	CountAccrualBacklog(ctx context.Context) (int64, error)
+	SetAccrual(ctx context.Context, accrual model.Accrual, owner, from string) error
+}
+
+// notifier доставляет юзеру служебные сообщения, реализации в пакете notify
+type notifier interface {
+	Notify(ctx context.Context, msg model.Notification) error
 }
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/model"
+)
+
+// orderTransitions - допустимые смены статуса заказа: NEW -> REGISTERED -> PROCESSING -> PROCESSED/INVALID.
+// Промежуточные статусы можно пропустить: воркер опрашивает accrual раз в несколько секунд
+// и может застать заказ уже посчитанным. Назад и из финальных статусов переходов нет
+var orderTransitions = map[string][]string{
+	model.OrderStatusNew:        {model.OrderStatusRegistered, model.OrderStatusProcessing, model.OrderStatusProcessed, model.OrderStatusInvalid},
+	model.OrderStatusRegistered: {model.OrderStatusProcessing, model.OrderStatusProcessed, model.OrderStatusInvalid},
+	model.OrderStatusProcessing: {model.OrderStatusProcessed, model.OrderStatusInvalid},
+}
+
+// checkOrderTransition - повтор текущего статуса не переход, а пустой ответ: нефинальный статус можно повторять,
+// финальный - нет, заказ после него не трогаем
+func checkOrderTransition(from, to string) error {
+	if from == to && !model.IsFinalOrderStatus(from) {
+		return nil
+	}
+
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s -> %s", model.ErrIllegalOrderTransition, from, to)
+}
+
+// SetAccrual сохраняет ответ accrual, если переход из текущего статуса допустим
+func (s service) SetAccrual(ctx context.Context, accrual model.Accrual, owner string) error {
+	ctx, span := tracer.Start(ctx, "service.SetAccrual")
+	defer span.End()
+
+	from, err := s.gmRepo.GetOrderStatus(ctx, accrual.Order)
+	if err != nil {
+		return fmt.Errorf("SetAccrual-GetOrderStatus-err: %w", err)
+	}
+
+	if err = checkOrderTransition(from, accrual.Status); err != nil {
+		return fmt.Errorf("SetAccrual-checkOrderTransition-err: %w", err)
+	}
+
+	return s.gmRepo.SetAccrual(ctx, accrual, owner, from)
+}
+
+// GetOrder отдает заказ юзера с историей статусов
+func (s service) GetOrder(ctx context.Context, userID int64, orderID string) (model.OrderDetails, error) {
+	ctx, span := tracer.Start(ctx, "service.GetOrder")
+	defer span.End()
+
+	order, err := s.gmRepo.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return model.OrderDetails{}, fmt.Errorf("GetOrder-GetOrder-err: %w", err)
+	}
+
+	history, err := s.gmRepo.GetOrderStatusHistory(ctx, orderID)
+	if err != nil {
+		return model.OrderDetails{}, fmt.Errorf("GetOrder-GetOrderStatusHistory-err: %w", err)
+	}
+
+	return model.OrderDetails{Order: order, History: history}, nil
+}
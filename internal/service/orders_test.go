@@ -0,0 +1,39 @@
+package service
+
+import (
+	"gophermart/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckOrderTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		legal    bool
+	}{
+		{from: model.OrderStatusNew, to: model.OrderStatusRegistered, legal: true},
+		{from: model.OrderStatusRegistered, to: model.OrderStatusProcessing, legal: true},
+		{from: model.OrderStatusProcessing, to: model.OrderStatusProcessed, legal: true},
+		{from: model.OrderStatusProcessing, to: model.OrderStatusInvalid, legal: true},
+		{from: model.OrderStatusNew, to: model.OrderStatusProcessed, legal: true},
+		{from: model.OrderStatusProcessing, to: model.OrderStatusProcessing, legal: true},
+		{from: model.OrderStatusProcessed, to: model.OrderStatusProcessing},
+		{from: model.OrderStatusProcessing, to: model.OrderStatusRegistered},
+		{from: model.OrderStatusInvalid, to: model.OrderStatusProcessed},
+		{from: model.OrderStatusProcessed, to: model.OrderStatusProcessed},
+		{from: model.OrderStatusRegistered, to: model.OrderStatusNew},
+		{from: model.OrderStatusNew, to: "DONE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			err := checkOrderTransition(tt.from, tt.to)
+			if tt.legal {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, model.ErrIllegalOrderTransition)
+		})
+	}
+}
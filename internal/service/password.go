@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/crypto"
+	"gophermart/internal/model"
+	"strconv"
+	"time"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+// ChangePassword меняет пароль по текущему. Все ранее выданные токены юзера перестают действовать
+func (s service) ChangePassword(ctx context.Context, userID int64, currentPass, newPass string) error {
+	ctx, span := tracer.Start(ctx, "service.ChangePassword")
+	defer span.End()
+
+	if newPass == "" {
+		return model.ErrEmptyPassword
+	}
+
+	keys := s.passwordChangeKeys(userID)
+	if err := s.checkLoginLock(ctx, keys); err != nil {
+		return fmt.Errorf("ChangePassword-checkLoginLock-err: %w", err)
+	}
+
+	passFromDB, err := s.gmRepo.GetPassword(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-GetPassword-err: %w", err)
+	}
+
+	ok, err := s.verifyPassword(currentPass, passFromDB)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-verifyPassword-err: %w", err)
+	}
+
+	if !ok {
+		s.registerLoginFailure(ctx, keys)
+		return model.ErrWrongPas
+	}
+
+	hashPass, err := s.hasher.Hash(newPass)
+	if err != nil {
+		return fmt.Errorf("ChangePassword-Hash-err: %w", err)
+	}
+
+	if err := s.gmRepo.ChangePassword(ctx, userID, hashPass); err != nil {
+		return fmt.Errorf("ChangePassword-ChangePassword-err: %w", err)
+	}
+
+	s.resetThrottle(ctx, keys)
+	return nil
+}
+
+// RequestPasswordReset выпускает одноразовый токен сброса пароля и отправляет его юзеру через нотификатор.
+// Сам токен нигде не сохраняется, в базе только его хеш
+func (s service) RequestPasswordReset(ctx context.Context, login string) error {
+	ctx, span := tracer.Start(ctx, "service.RequestPasswordReset")
+	defer span.End()
+
+	if s.notifier == nil {
+		return model.ErrNotifierNotDefined
+	}
+
+	userID, _, err := s.gmRepo.GetAuthInfo(ctx, login)
+	if err != nil {
+		return fmt.Errorf("RequestPasswordReset-GetAuthInfo-err: %w", err)
+	}
+
+	token, hash, err := crypto.NewToken()
+	if err != nil {
+		return fmt.Errorf("RequestPasswordReset-NewToken-err: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.passwordResetTTL)
+	if err := s.gmRepo.AddPasswordResetToken(ctx, hash, userID, expiresAt); err != nil {
+		return fmt.Errorf("RequestPasswordReset-AddPasswordResetToken-err: %w", err)
+	}
+
+	err = s.notifier.Notify(ctx, model.Notification{
+		UserID:  userID,
+		Login:   login,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Use token %s in POST /api/user/password/reset to set a new password. The token expires at %s.",
+			token, expiresAt.UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return fmt.Errorf("RequestPasswordReset-Notify-err: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword задает новый пароль по токену сброса. Как и при смене пароля, все токены юзера отзываются
+func (s service) ResetPassword(ctx context.Context, token, newPass string) error {
+	ctx, span := tracer.Start(ctx, "service.ResetPassword")
+	defer span.End()
+
+	if newPass == "" {
+		return model.ErrEmptyPassword
+	}
+
+	hashPass, err := s.hasher.Hash(newPass)
+	if err != nil {
+		return fmt.Errorf("ResetPassword-Hash-err: %w", err)
+	}
+
+	userID, err := s.gmRepo.ResetPassword(ctx, crypto.HashToken(token), hashPass)
+	if err != nil {
+		return fmt.Errorf("ResetPassword-ResetPassword-err: %w", err)
+	}
+
+	// после сброса пароля юзер должен снова войти, даже если до этого был заблокирован за перебор
+	s.resetThrottle(ctx, s.passwordChangeKeys(userID))
+	return nil
+}
+
+// TokensValidAfter возвращает момент, раньше которого access-токены юзера не принимаются
+func (s service) TokensValidAfter(ctx context.Context, userID int64) (time.Time, error) {
+	ctx, span := tracer.Start(ctx, "service.TokensValidAfter")
+	defer span.End()
+
+	changedAt, err := s.gmRepo.GetTokensValidAfter(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrWrongLogin) {
+			return time.Time{}, model.ErrTokenRevoked
+		}
+		return time.Time{}, fmt.Errorf("TokensValidAfter-GetTokensValidAfter-err: %w", err)
+	}
+
+	return changedAt, nil
+}
+
+func (s service) passwordChangeKeys(userID int64) []throttleKey {
+	return []throttleKey{{key: "password:" + strconv.FormatInt(userID, 10), free: s.loginThrottle.FreeAttempts}}
+}
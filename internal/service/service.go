@@ -2,71 +2,282 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"gophermart/internal/crypto"
+	"gophermart/internal/logger"
 	"gophermart/internal/model"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 )
 
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var tracer = otel.Tracer("gophermart/internal/service")
+
 type service struct {
-	gmRepo    gophermartRepo
-	encrypter crypto.PasswordEncrypter
+	gmRepo            gophermartRepo
+	hasher            crypto.PasswordHasher
+	legacyEncrypter   crypto.PasswordEncrypter
+	secretEncrypter   crypto.PasswordEncrypter // шифрует секреты TOTP в базе
+	refreshTokenTTL   time.Duration
+	loginChallengeTTL time.Duration
+	loginThrottle     LoginThrottle
+	notifier          notifier
+	passwordResetTTL  time.Duration
+	dummyHash         string // хеш, с которым сравнивается пароль несуществующего логина, чтобы время ответа не выдавало логины
+}
+
+// Option описывает функциональную опцию для конфигурации сервиса.
+type Option func(*service)
+
+// WithRefreshTokenTTL задает время жизни refresh-токенов.
+func WithRefreshTokenTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		s.refreshTokenTTL = ttl
+	}
+}
+
+// WithSecretEncrypter задает шифрование секретов TOTP. Без него 2FA недоступна
+func WithSecretEncrypter(encrypter crypto.PasswordEncrypter) Option {
+	return func(s *service) {
+		s.secretEncrypter = encrypter
+	}
 }
 
-func New(gmRepo gophermartRepo, encrypter crypto.PasswordEncrypter) *service {
-	return &service{gmRepo: gmRepo, encrypter: encrypter}
+// WithLoginChallengeTTL задает, сколько ждать код второго фактора после проверки пароля.
+func WithLoginChallengeTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		s.loginChallengeTTL = ttl
+	}
+}
+
+// WithNotifier задает доставку служебных сообщений юзерам, например токенов сброса пароля.
+func WithNotifier(n notifier) Option {
+	return func(s *service) {
+		s.notifier = n
+	}
+}
+
+// WithPasswordResetTTL задает время жизни токена сброса пароля.
+func WithPasswordResetTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		s.passwordResetTTL = ttl
+	}
+}
+
+// WithLoginThrottle задает политику блокировки входа.
+func WithLoginThrottle(throttle LoginThrottle) Option {
+	return func(s *service) {
+		s.loginThrottle = throttle
+	}
+}
+
+// New создает сервис. legacyEncrypter нужен только для проверки паролей, сохраненных до перехода на хеширование
+func New(gmRepo gophermartRepo, hasher crypto.PasswordHasher, legacyEncrypter crypto.PasswordEncrypter, options ...Option) *service {
+	s := &service{
+		gmRepo:            gmRepo,
+		hasher:            hasher,
+		legacyEncrypter:   legacyEncrypter,
+		refreshTokenTTL:   defaultRefreshTokenTTL,
+		loginChallengeTTL: defaultLoginChallengeTTL,
+		loginThrottle:     DefaultLoginThrottle,
+		passwordResetTTL:  defaultPasswordResetTTL,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	if dummyHash, err := hasher.Hash("dummy password"); err == nil {
+		s.dummyHash = dummyHash
+	}
+
+	return s
 }
 
 func (s service) AddAuthInfo(ctx context.Context, login, pass string) (int64, error) {
-	encodedPass, err := s.encrypter.PassEncrypt(pass)
+	ctx, span := tracer.Start(ctx, "service.AddAuthInfo")
+	defer span.End()
+
+	hashPass, err := s.hasher.Hash(pass)
 	if err != nil {
-		return 0, fmt.Errorf("AddAuthInfo-PassEncrypt-err: %w", err)
+		return 0, fmt.Errorf("AddAuthInfo-Hash-err: %w", err)
 	}
 
-	return s.gmRepo.AddAuthInfo(ctx, login, encodedPass)
+	return s.gmRepo.AddAuthInfo(ctx, login, hashPass)
 }
 
-func (s service) GetAuthInfo(ctx context.Context, login, pass string) (int64, error) {
-	userID, encryptPassFromDB, err := s.gmRepo.GetAuthInfo(ctx, login)
+// GetAuthInfo проверяет логин и пароль. ip нужен для блокировки перебора с одного адреса
+func (s service) GetAuthInfo(ctx context.Context, login, pass, ip string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "service.GetAuthInfo")
+	defer span.End()
+
+	keys := s.throttleKeys(login, ip)
+	if err := s.checkLoginLock(ctx, keys); err != nil {
+		return 0, fmt.Errorf("GetAuthInfo-checkLoginLock-err: %w", err)
+	}
+
+	userID, passFromDB, err := s.gmRepo.GetAuthInfo(ctx, login)
 	if err != nil {
+		if errors.Is(err, model.ErrWrongLogin) {
+			s.hasher.Verify(pass, s.dummyHash)
+			s.registerLoginFailure(ctx, keys)
+		}
 		return 0, fmt.Errorf("GetAuthInfo-GetAuthInfo-err: %w", err)
 	}
 
-	passFromDB, err := s.encrypter.PassDecrypt(encryptPassFromDB)
+	ok, err := s.verifyPassword(pass, passFromDB)
 	if err != nil {
-		return 0, fmt.Errorf("GetAuthInfo-PassDecrypt-err: %w", err)
+		return 0, fmt.Errorf("GetAuthInfo-verifyPassword-err: %w", err)
 	}
 
-	if passFromDB != pass {
+	if !ok {
+		s.registerLoginFailure(ctx, keys)
 		return 0, model.ErrWrongPas
 	}
 
+	s.resetLoginFailures(ctx, login)
+
+	// пароль верный - самое время перехешировать его, если он лежит в старом формате или с устаревшими параметрами
+	if s.hasher.NeedsRehash(passFromDB) {
+		s.rehashPassword(ctx, userID, pass, passFromDB)
+	}
+
 	return userID, nil
 }
 
+// verifyPassword проверяет пароль по хешу, а для старых записей - по AES-шифротексту
+func (s service) verifyPassword(pass, passFromDB string) (bool, error) {
+	ok, err := s.hasher.Verify(pass, passFromDB)
+	if !errors.Is(err, crypto.ErrUnknownHashFormat) {
+		return ok, err
+	}
+
+	if s.legacyEncrypter == nil {
+		return false, err
+	}
+
+	decrypted, err := s.legacyEncrypter.PassDecrypt(passFromDB)
+	if err != nil {
+		return false, fmt.Errorf("verifyPassword-PassDecrypt-err: %w", err)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(decrypted), []byte(pass)) == 1, nil
+}
+
+// rehashPassword сохраняет новый хеш пароля вместо passFromDB. Ошибка не мешает логину, пароль перехешируется при следующем входе.
+// Если пароль успели сменить после проверки, перехеширование пропускается, чтобы не вернуть старый
+func (s service) rehashPassword(ctx context.Context, userID int64, pass, passFromDB string) {
+	hashPass, err := s.hasher.Hash(pass)
+	if err != nil {
+		logger.Log.Warn("GetAuthInfo rehash password error", zap.Int64("user_id", userID), zap.Error(err))
+		return
+	}
+
+	updated, err := s.gmRepo.UpdatePassword(ctx, userID, passFromDB, hashPass)
+	if err != nil {
+		logger.Log.Warn("GetAuthInfo rehash password error", zap.Int64("user_id", userID), zap.Error(err))
+		return
+	}
+	if !updated {
+		logger.Log.Info("GetAuthInfo password changed concurrently, rehash skipped", zap.Int64("user_id", userID))
+		return
+	}
+
+	logger.Log.Info("GetAuthInfo password rehashed", zap.Int64("user_id", userID))
+}
+
 func (s service) AddOrder(ctx context.Context, orderID string, userID int64) error {
+	ctx, span := tracer.Start(ctx, "service.AddOrder")
+	defer span.End()
+
 	return s.gmRepo.AddOrder(ctx, orderID, userID)
 }
 
 func (s service) GetOrders(ctx context.Context, userID int64) ([]model.Order, error) {
+	ctx, span := tracer.Start(ctx, "service.GetOrders")
+	defer span.End()
+
 	return s.gmRepo.GetOrders(ctx, userID)
 }
 
 func (s service) GetBalance(ctx context.Context, userID int64) (model.Balance, error) {
+	ctx, span := tracer.Start(ctx, "service.GetBalance")
+	defer span.End()
+
 	return s.gmRepo.GetBalance(ctx, userID)
 }
 
+func (s service) GetBalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	ctx, span := tracer.Start(ctx, "service.GetBalanceHistory")
+	defer span.End()
+
+	return s.gmRepo.GetBalanceHistory(ctx, userID)
+}
+
 func (s service) Withdraw(ctx context.Context, withdraw model.Withdraw) error {
+	ctx, span := tracer.Start(ctx, "service.Withdraw")
+	defer span.End()
+
 	return s.gmRepo.Withdraw(ctx, withdraw)
 }
 
 func (s service) GetWithdrawals(ctx context.Context, userID int64) ([]model.Withdraw, error) {
+	ctx, span := tracer.Start(ctx, "service.GetWithdrawals")
+	defer span.End()
+
 	return s.gmRepo.GetWithdrawals(ctx, userID)
 }
 
-func (s service) GetOrderForAccrual(ctx context.Context) (string, error) {
-	return s.gmRepo.GetOrderForAccrual(ctx)
+func (s service) ClaimOrdersForAccrual(ctx context.Context, owner string, limit int, leaseTTL time.Duration) ([]model.AccrualJob, error) {
+	ctx, span := tracer.Start(ctx, "service.ClaimOrdersForAccrual")
+	defer span.End()
+
+	return s.gmRepo.ClaimOrdersForAccrual(ctx, owner, limit, leaseTTL)
+}
+
+func (s service) FailOrderAttempt(ctx context.Context, orderID, owner, lastErr string, retryIn time.Duration, deadLetter bool) error {
+	ctx, span := tracer.Start(ctx, "service.FailOrderAttempt")
+	defer span.End()
+
+	return s.gmRepo.FailOrderAttempt(ctx, orderID, owner, lastErr, retryIn, deadLetter)
 }
 
-func (s service) SetAccrual(ctx context.Context, accrual model.Accrual) error {
-	return s.gmRepo.SetAccrual(ctx, accrual)
+func (s service) ExtendOrderLeases(ctx context.Context, owner string, leaseTTL time.Duration) error {
+	ctx, span := tracer.Start(ctx, "service.ExtendOrderLeases")
+	defer span.End()
+
+	return s.gmRepo.ExtendOrderLeases(ctx, owner, leaseTTL)
+}
+
+func (s service) ReleaseOrderLeases(ctx context.Context, owner string) error {
+	ctx, span := tracer.Start(ctx, "service.ReleaseOrderLeases")
+	defer span.End()
+
+	return s.gmRepo.ReleaseOrderLeases(ctx, owner)
+}
+
+func (s service) GetNextOrderDelay(ctx context.Context) (time.Duration, bool, error) {
+	ctx, span := tracer.Start(ctx, "service.GetNextOrderDelay")
+	defer span.End()
+
+	return s.gmRepo.GetNextOrderDelay(ctx)
+}
+
+func (s service) CountAccrualBacklog(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "service.CountAccrualBacklog")
+	defer span.End()
+
+	return s.gmRepo.CountAccrualBacklog(ctx)
+}
+
+func (s service) SetAccrualBackoff(ctx context.Context, d time.Duration) error {
+	ctx, span := tracer.Start(ctx, "service.SetAccrualBackoff")
+	defer span.End()
+
+	return s.gmRepo.SetAccrualBackoff(ctx, d)
 }
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"gophermart/internal/logger"
+	"gophermart/internal/model"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LoginThrottle - политика блокировки входа после неудачных попыток.
+// Первые FreeAttempts неудач прощаются, дальше каждая следующая блокирует вход
+// на BaseLockout, 2*BaseLockout, 4*BaseLockout... но не больше MaxLockout.
+type LoginThrottle struct {
+	FreeAttempts   int           // неудач подряд по одному логину без блокировки
+	IPFreeAttempts int           // неудач подряд с одного IP без блокировки, с NAT'а могут входить многие
+	BaseLockout    time.Duration // первая блокировка
+	MaxLockout     time.Duration // потолок блокировки
+	Window         time.Duration // если неудач не было столько времени, счетчик начинается заново
+}
+
+var DefaultLoginThrottle = LoginThrottle{
+	FreeAttempts:   5,
+	IPFreeAttempts: 50,
+	BaseLockout:    30 * time.Second,
+	MaxLockout:     time.Hour,
+	Window:         24 * time.Hour,
+}
+
+// lockout возвращает длительность блокировки после failures неудач подряд
+func (t LoginThrottle) lockout(failures, free int) time.Duration {
+	if failures <= free {
+		return 0
+	}
+
+	lock := t.BaseLockout
+	for i := free + 1; i < failures && lock < t.MaxLockout; i++ {
+		lock *= 2
+	}
+
+	return min(lock, t.MaxLockout)
+}
+
+type throttleKey struct {
+	key  string
+	free int
+}
+
+func (s service) throttleKeys(login, ip string) []throttleKey {
+	keys := []throttleKey{{key: "login:" + login, free: s.loginThrottle.FreeAttempts}}
+	if ip != "" {
+		keys = append(keys, throttleKey{key: "ip:" + ip, free: s.loginThrottle.IPFreeAttempts})
+	}
+	return keys
+}
+
+// checkLoginLock возвращает LoginLockedError, если вход по логину или с IP сейчас заблокирован
+func (s service) checkLoginLock(ctx context.Context, keys []throttleKey) error {
+	lockKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lockKeys = append(lockKeys, k.key)
+	}
+
+	lock, err := s.gmRepo.GetLoginLock(ctx, lockKeys)
+	if err != nil {
+		return err
+	}
+
+	if lock > 0 {
+		return model.LoginLockedError{RetryAfter: lock}
+	}
+
+	return nil
+}
+
+// registerLoginFailure считает неудачную попытку и при необходимости блокирует вход.
+// Ошибки только логируются: юзер в любом случае получит отказ во входе.
+func (s service) registerLoginFailure(ctx context.Context, keys []throttleKey) {
+	for _, k := range keys {
+		failures, err := s.gmRepo.AddLoginFailure(ctx, k.key, s.loginThrottle.Window)
+		if err != nil {
+			logger.Log.Error("registerLoginFailure AddLoginFailure error", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		lock := s.loginThrottle.lockout(failures, k.free)
+		if lock == 0 {
+			continue
+		}
+
+		if err := s.gmRepo.SetLoginLock(ctx, k.key, lock); err != nil {
+			logger.Log.Error("registerLoginFailure SetLoginLock error", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		logger.Log.Warn("login locked", zap.String("key", k.key), zap.Int("failures", failures), zap.Duration("lock", lock))
+	}
+}
+
+// resetThrottle обнуляет счетчики неудачных попыток по ключам
+func (s service) resetThrottle(ctx context.Context, keys []throttleKey) {
+	for _, k := range keys {
+		if err := s.gmRepo.ResetLoginFailures(ctx, k.key); err != nil {
+			logger.Log.Error("resetThrottle error", zap.String("key", k.key), zap.Error(err))
+		}
+	}
+}
+
+// resetLoginFailures обнуляет счетчик по логину после успешного входа. Счетчик по IP не сбрасывается,
+// иначе перебор с одного адреса можно было бы разбавлять входами в свой аккаунт
+func (s service) resetLoginFailures(ctx context.Context, login string) {
+	if err := s.gmRepo.ResetLoginFailures(ctx, "login:"+login); err != nil {
+		logger.Log.Error("resetLoginFailures error", zap.String("login", login), zap.Error(err))
+	}
+}
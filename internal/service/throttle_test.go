@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottleLockout(t *testing.T) {
+	throttle := LoginThrottle{
+		FreeAttempts: 3,
+		BaseLockout:  time.Second,
+		MaxLockout:   10 * time.Second,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 1000, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, throttle.lockout(tt.failures, throttle.FreeAttempts), "failures: %d", tt.failures)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/crypto"
+	"gophermart/internal/model"
+	"time"
+)
+
+// IssueRefreshToken выдает refresh-токен нового семейства, например при логине
+func (s service) IssueRefreshToken(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracer.Start(ctx, "service.IssueRefreshToken")
+	defer span.End()
+
+	familyID, _, err := crypto.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("IssueRefreshToken-NewToken-err: %w", err)
+	}
+
+	token, hash, err := crypto.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("IssueRefreshToken-NewToken-err: %w", err)
+	}
+
+	err = s.gmRepo.AddRefreshToken(ctx, model.RefreshToken{
+		Hash:      hash,
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("IssueRefreshToken-AddRefreshToken-err: %w", err)
+	}
+
+	return token, nil
+}
+
+// RefreshToken обменивает refresh-токен на новый и возвращает юзера, для которого нужно выпустить access-токен
+func (s service) RefreshToken(ctx context.Context, refreshToken string) (int64, string, error) {
+	ctx, span := tracer.Start(ctx, "service.RefreshToken")
+	defer span.End()
+
+	token, hash, err := crypto.NewToken()
+	if err != nil {
+		return 0, "", fmt.Errorf("RefreshToken-NewToken-err: %w", err)
+	}
+
+	newToken, err := s.gmRepo.RotateRefreshToken(ctx, crypto.HashToken(refreshToken), model.RefreshToken{
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("RefreshToken-RotateRefreshToken-err: %w", err)
+	}
+
+	return newToken.UserID, token, nil
+}
+
+// Logout отзывает все семейство refresh-токена
+func (s service) Logout(ctx context.Context, refreshToken string) error {
+	ctx, span := tracer.Start(ctx, "service.Logout")
+	defer span.End()
+
+	if err := s.gmRepo.RevokeRefreshTokenFamily(ctx, crypto.HashToken(refreshToken)); err != nil {
+		return fmt.Errorf("Logout-RevokeRefreshTokenFamily-err: %w", err)
+	}
+
+	return nil
+}
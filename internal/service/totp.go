@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophermart/internal/crypto"
+	"gophermart/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer = "Gophermart"
+	// допуск в один интервал в обе стороны на рассинхрон часов телефона
+	totpSkew           = 1
+	recoveryCodesCount = 10
+
+	defaultLoginChallengeTTL = 5 * time.Minute
+)
+
+// SetupTOTP начинает подключение 2FA: генерирует секрет и отдает otpauth ссылку для аутентификатора.
+// 2FA включится только после ConfirmTOTP
+func (s service) SetupTOTP(ctx context.Context, userID int64) (model.TOTPSetup, error) {
+	ctx, span := tracer.Start(ctx, "service.SetupTOTP")
+	defer span.End()
+
+	login, err := s.gmRepo.GetLogin(ctx, userID)
+	if err != nil {
+		return model.TOTPSetup{}, fmt.Errorf("SetupTOTP-GetLogin-err: %w", err)
+	}
+
+	if s.secretEncrypter == nil {
+		return model.TOTPSetup{}, model.ErrSecretEncrypterNotDefined
+	}
+
+	secret, err := crypto.NewTOTPSecret()
+	if err != nil {
+		return model.TOTPSetup{}, fmt.Errorf("SetupTOTP-NewTOTPSecret-err: %w", err)
+	}
+
+	encrypted, err := s.secretEncrypter.PassEncrypt(secret)
+	if err != nil {
+		return model.TOTPSetup{}, fmt.Errorf("SetupTOTP-PassEncrypt-err: %w", err)
+	}
+
+	if err := s.gmRepo.SetTOTPSecret(ctx, userID, encrypted); err != nil {
+		return model.TOTPSetup{}, fmt.Errorf("SetupTOTP-SetTOTPSecret-err: %w", err)
+	}
+
+	return model.TOTPSetup{Secret: secret, URI: crypto.TOTPURI(totpIssuer, login, secret)}, nil
+}
+
+// ConfirmTOTP включает 2FA, если юзер ввел верный код из аутентификатора, и выдает коды восстановления
+func (s service) ConfirmTOTP(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error) {
+	ctx, span := tracer.Start(ctx, "service.ConfirmTOTP")
+	defer span.End()
+
+	keys := s.secondFactorKeys(userID)
+	if err := s.checkLoginLock(ctx, keys); err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("ConfirmTOTP-checkLoginLock-err: %w", err)
+	}
+
+	totp, err := s.gmRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrTOTPNotEnabled) {
+			return model.RecoveryCodes{}, model.ErrTOTPSetupNotFound
+		}
+		return model.RecoveryCodes{}, fmt.Errorf("ConfirmTOTP-GetTOTP-err: %w", err)
+	}
+
+	if totp.Enabled {
+		return model.RecoveryCodes{}, model.ErrTOTPAlreadyEnabled
+	}
+
+	step, ok, err := s.validateTOTP(totp, code)
+	if err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("ConfirmTOTP-validateTOTP-err: %w", err)
+	}
+
+	if !ok {
+		s.registerLoginFailure(ctx, keys)
+		return model.RecoveryCodes{}, model.ErrWrongTOTPCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("ConfirmTOTP-newRecoveryCodes-err: %w", err)
+	}
+
+	if err := s.gmRepo.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("ConfirmTOTP-EnableTOTP-err: %w", err)
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes выдает новый набор кодов восстановления взамен старого
+func (s service) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (model.RecoveryCodes, error) {
+	ctx, span := tracer.Start(ctx, "service.RegenerateRecoveryCodes")
+	defer span.End()
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("RegenerateRecoveryCodes-verifySecondFactor-err: %w", err)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("RegenerateRecoveryCodes-newRecoveryCodes-err: %w", err)
+	}
+
+	if err := s.gmRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return model.RecoveryCodes{}, fmt.Errorf("RegenerateRecoveryCodes-ReplaceRecoveryCodes-err: %w", err)
+	}
+
+	return codes, nil
+}
+
+// SetWithdrawStepUp включает или выключает подтверждение списаний кодом. Меняется тоже только с кодом
+func (s service) SetWithdrawStepUp(ctx context.Context, userID int64, required bool, code string) error {
+	ctx, span := tracer.Start(ctx, "service.SetWithdrawStepUp")
+	defer span.End()
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return fmt.Errorf("SetWithdrawStepUp-verifySecondFactor-err: %w", err)
+	}
+
+	if err := s.gmRepo.SetWithdrawStepUp(ctx, userID, required); err != nil {
+		return fmt.Errorf("SetWithdrawStepUp-SetWithdrawStepUp-err: %w", err)
+	}
+
+	return nil
+}
+
+// CheckWithdrawStepUp проверяет код второго фактора перед списанием, если юзер включил такое подтверждение
+func (s service) CheckWithdrawStepUp(ctx context.Context, userID int64, code string) error {
+	ctx, span := tracer.Start(ctx, "service.CheckWithdrawStepUp")
+	defer span.End()
+
+	totp, err := s.gmRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrTOTPNotEnabled) {
+			return nil
+		}
+		return fmt.Errorf("CheckWithdrawStepUp-GetTOTP-err: %w", err)
+	}
+
+	if !totp.Enabled || !totp.WithdrawStepUp {
+		return nil
+	}
+
+	if code == "" {
+		return model.ErrSecondFactorRequired
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return fmt.Errorf("CheckWithdrawStepUp-verifySecondFactor-err: %w", err)
+	}
+
+	return nil
+}
+
+// BeginSecondFactor вызывается после проверки пароля. Если у юзера включена 2FA,
+// возвращает токен незавершенного логина, который нужно предъявить вместе с кодом.
+// Пустой токен - второй шаг не нужен
+func (s service) BeginSecondFactor(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracer.Start(ctx, "service.BeginSecondFactor")
+	defer span.End()
+
+	totp, err := s.gmRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, model.ErrTOTPNotEnabled) {
+			return "", nil
+		}
+		return "", fmt.Errorf("BeginSecondFactor-GetTOTP-err: %w", err)
+	}
+
+	if !totp.Enabled {
+		return "", nil
+	}
+
+	token, hash, err := crypto.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("BeginSecondFactor-NewToken-err: %w", err)
+	}
+
+	if err := s.gmRepo.AddLoginChallenge(ctx, hash, userID, time.Now().Add(s.loginChallengeTTL)); err != nil {
+		return "", fmt.Errorf("BeginSecondFactor-AddLoginChallenge-err: %w", err)
+	}
+
+	return token, nil
+}
+
+// CompleteSecondFactor завершает логин кодом второго фактора и возвращает юзера
+func (s service) CompleteSecondFactor(ctx context.Context, challenge, code string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "service.CompleteSecondFactor")
+	defer span.End()
+
+	hash := crypto.HashToken(challenge)
+
+	userID, err := s.gmRepo.GetLoginChallenge(ctx, hash)
+	if err != nil {
+		return 0, fmt.Errorf("CompleteSecondFactor-GetLoginChallenge-err: %w", err)
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return 0, fmt.Errorf("CompleteSecondFactor-verifySecondFactor-err: %w", err)
+	}
+
+	if err := s.gmRepo.DeleteLoginChallenge(ctx, hash); err != nil {
+		return 0, fmt.Errorf("CompleteSecondFactor-DeleteLoginChallenge-err: %w", err)
+	}
+
+	return userID, nil
+}
+
+// verifySecondFactor принимает код из аутентификатора или одноразовый код восстановления.
+// Неудачные попытки считаются так же, как неудачные логины, иначе 6 цифр легко перебрать
+func (s service) verifySecondFactor(ctx context.Context, userID int64, code string) error {
+	keys := s.secondFactorKeys(userID)
+	if err := s.checkLoginLock(ctx, keys); err != nil {
+		return err
+	}
+
+	totp, err := s.gmRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !totp.Enabled {
+		return model.ErrTOTPNotEnabled
+	}
+
+	if strings.Contains(code, "-") {
+		err = s.gmRepo.UseRecoveryCode(ctx, userID, crypto.HashToken(crypto.NormalizeRecoveryCode(code)))
+	} else {
+		err = s.useTOTPCode(ctx, userID, totp, code)
+	}
+
+	if errors.Is(err, model.ErrWrongTOTPCode) {
+		s.registerLoginFailure(ctx, keys)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	s.resetThrottle(ctx, keys)
+	return nil
+}
+
+func (s service) useTOTPCode(ctx context.Context, userID int64, totp model.TOTP, code string) error {
+	step, ok, err := s.validateTOTP(totp, code)
+	if err != nil {
+		return err
+	}
+
+	if !ok || step <= totp.LastUsedStep {
+		return model.ErrWrongTOTPCode
+	}
+
+	return s.gmRepo.UseTOTPStep(ctx, userID, step)
+}
+
+func (s service) validateTOTP(totp model.TOTP, code string) (int64, bool, error) {
+	if s.secretEncrypter == nil {
+		return 0, false, model.ErrSecretEncrypterNotDefined
+	}
+
+	secret, err := s.secretEncrypter.PassDecrypt(totp.Secret)
+	if err != nil {
+		return 0, false, fmt.Errorf("validateTOTP-PassDecrypt-err: %w", err)
+	}
+
+	return crypto.ValidateTOTP(secret, code, time.Now(), totpSkew)
+}
+
+func (s service) secondFactorKeys(userID int64) []throttleKey {
+	return []throttleKey{{key: "2fa:" + strconv.FormatInt(userID, 10), free: s.loginThrottle.FreeAttempts}}
+}
+
+func newRecoveryCodes() (model.RecoveryCodes, []string, error) {
+	codes := model.RecoveryCodes{Codes: make([]string, 0, recoveryCodesCount)}
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := crypto.NewRecoveryCode()
+		if err != nil {
+			return model.RecoveryCodes{}, nil, err
+		}
+
+		codes.Codes = append(codes.Codes, code)
+		hashes = append(hashes, crypto.HashToken(code))
+	}
+
+	return codes, hashes, nil
+}
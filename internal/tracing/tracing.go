@@ -0,0 +1,107 @@
+// Package tracing настраивает OpenTelemetry: глобальный TracerProvider, экспорт спанов и W3C-пропагацию контекста.
+// Спаны создают сами пакеты через otel.Tracer, здесь только выбирается, куда они уходят.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serviceName = "gophermart"
+
+// ShutdownFunc выгружает накопленные спаны и останавливает экспорт
+type ShutdownFunc func(ctx context.Context) error
+
+// Init включает трейсинг по описанию из конфига:
+//   - "" или "none" - трейсинг выключен, спаны не пишутся;
+//   - "stdout" - спаны в stdout, для локального запуска;
+//   - "file:/path/to/file" - спаны в файл JSON-объектами;
+//   - "otlp" - OTLP/HTTP, адрес берется из стандартных OTEL_EXPORTER_OTLP_* переменных;
+//   - "otlp:http://collector:4318" - OTLP/HTTP на указанный адрес.
+//
+// Входящий контекст трейса принимается и передается дальше в любом случае
+func Init(ctx context.Context, spec string) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, closer, err := newExporter(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing.Init-resource-err: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// newExporter возвращает nil, если трейсинг выключен. closer - файл, который надо закрыть после экспортера
+func newExporter(ctx context.Context, spec string) (sdktrace.SpanExporter, io.Closer, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "", "none":
+		return nil, nil, nil
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("tracing.Init-stdouttrace-err: %w", err)
+		}
+		return exporter, nil, nil
+	case "file":
+		if arg == "" {
+			return nil, nil, fmt.Errorf("tracing.Init: empty file path in %q", spec)
+		}
+		f, err := os.OpenFile(arg, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tracing.Init-OpenFile-err: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("tracing.Init-stdouttrace-err: %w", err)
+		}
+		return exporter, f, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if arg != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(arg))
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tracing.Init-otlptracehttp-err: %w", err)
+		}
+		return exporter, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("tracing.Init: unknown exporter %q", spec)
+	}
+}
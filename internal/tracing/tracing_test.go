@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := Init(context.Background(), "jaeger")
+		assert.Error(t, err)
+	})
+
+	t.Run("file without path", func(t *testing.T) {
+		_, err := Init(context.Background(), "file:")
+		assert.Error(t, err)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := Init(context.Background(), "")
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("file exporter writes spans", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "spans.json")
+
+		shutdown, err := Init(context.Background(), "file:"+path)
+		require.NoError(t, err)
+
+		_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+		span.End()
+
+		require.NoError(t, shutdown(context.Background()))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"Name":"test-span"`)
+		assert.Contains(t, string(data), `"Value":"gophermart"`)
+	})
+}
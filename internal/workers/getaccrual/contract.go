@@ -2,14 +2,21 @@ package getaccrual
 
 import (
 	"context"
+	accrualclient "gophermart/internal/accrual"
 	"gophermart/internal/model"
+	"time"
 )
 
 type accrualService interface {
-	GetAccrual(orderID string) (int, model.Accrual, error)
+	GetAccrual(ctx context.Context, orderID string) (accrualclient.Result, error)
 }
 
 type storager interface {
-	GetOrderForAccrual(ctx context.Context) (string, error)
-	SetAccrual(ctx context.Context, accrual model.Accrual) error
+	ClaimOrdersForAccrual(ctx context.Context, owner string, limit int, leaseTTL time.Duration) ([]model.AccrualJob, error)
+	FailOrderAttempt(ctx context.Context, orderID, owner, lastErr string, retryIn time.Duration, deadLetter bool) error
+	ExtendOrderLeases(ctx context.Context, owner string, leaseTTL time.Duration) error
+	ReleaseOrderLeases(ctx context.Context, owner string) error
+	SetAccrualBackoff(ctx context.Context, d time.Duration) error
+	GetNextOrderDelay(ctx context.Context) (time.Duration, bool, error)
+	SetAccrual(ctx context.Context, accrual model.Accrual, owner string) error
 }
@@ -0,0 +1,37 @@
+package getaccrual
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy - повторы заказа, по которому accrual отвечает ошибкой: экспоненциальная пауза с jitter
+// и dead letter после MaxAttempts неудач подряд
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy: 5s, 10s, 20s ... до часа, всего 10 попыток - около трех часов
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 10,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// next возвращает паузу перед следующей попыткой после attempts неудач, или deadLetter, если попытки кончились
+func (p RetryPolicy) next(attempts int) (delay time.Duration, deadLetter bool) {
+	if attempts >= p.MaxAttempts {
+		return 0, true
+	}
+
+	delay = p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	// половина паузы фиксирована, половина случайна: заказы, упавшие разом, не придут разом снова
+	return delay/2 + rand.N(delay/2+1), false
+}
@@ -0,0 +1,36 @@
+package getaccrual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: 35 * time.Second}
+
+	tests := []struct {
+		attempts   int
+		full       time.Duration
+		deadLetter bool
+	}{
+		{attempts: 1, full: 10 * time.Second},
+		{attempts: 2, full: 20 * time.Second},
+		{attempts: 3, full: 35 * time.Second},
+		{attempts: 4, full: 35 * time.Second},
+		{attempts: 5, deadLetter: true},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay, deadLetter := p.next(tt.attempts)
+			assert.Equal(t, tt.deadLetter, deadLetter)
+			if tt.deadLetter {
+				continue
+			}
+			assert.GreaterOrEqual(t, delay, tt.full/2)
+			assert.LessOrEqual(t, delay, tt.full)
+		}
+	}
+}
@@ -4,68 +4,270 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	accrualclient "gophermart/internal/accrual"
 	"gophermart/internal/logger"
-	"net/http"
-	"strconv"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+	"gophermart/internal/workers"
+	"os"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+var tracer = otel.Tracer("gophermart/internal/workers/getaccrual")
+
+const (
+	// DefaultPollInterval - страховочный опрос очереди, если NOTIFY потерялся
+	DefaultPollInterval = 10 * time.Second
+	// DefaultBatchSize - сколько заказов воркер берет в аренду за раз
+	DefaultBatchSize = 10
+	// DefaultLeaseTTL - на сколько берется аренда. Пока воркер жив, он ее продлевает, после падения заказы освободятся сами
+	DefaultLeaseTTL = 30 * time.Second
+	// minIdle не дает крутить цикл, если заказ вот-вот станет доступен
+	minIdle = 50 * time.Millisecond
+)
+
 type accrualWorker struct {
 	storager       storager
 	accrualService accrualService
+	pollInterval   time.Duration
+	batchSize      int
+	leaseTTL       time.Duration
+	instanceID     string
+	claims         atomic.Int64
+	retry          RetryPolicy
+}
+
+// Option описывает функциональную опцию для конфигурации воркера.
+type Option func(*accrualWorker)
+
+// WithPollInterval задает, как часто простаивающий воркер сам проверяет очередь без уведомлений
+func WithPollInterval(interval time.Duration) Option {
+	return func(w *accrualWorker) {
+		w.pollInterval = interval
+	}
+}
+
+// WithBatch задает размер батча и срок аренды заказов
+func WithBatch(size int, leaseTTL time.Duration) Option {
+	return func(w *accrualWorker) {
+		w.batchSize = size
+		w.leaseTTL = leaseTTL
+	}
 }
 
-func New(storager storager, accrualService accrualService) *accrualWorker {
-	accrualWorker := accrualWorker{
+// WithRetryPolicy задает повторы и dead letter для заказов, по которым accrual отвечает ошибкой
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(w *accrualWorker) {
+		w.retry = policy
+	}
+}
+
+func New(storager storager, accrualService accrualService, options ...Option) *accrualWorker {
+	hostname, _ := os.Hostname()
+
+	accrualWorker := &accrualWorker{
 		storager:       storager,
 		accrualService: accrualService,
+		pollInterval:   DefaultPollInterval,
+		batchSize:      DefaultBatchSize,
+		leaseTTL:       DefaultLeaseTTL,
+		instanceID:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		retry:          DefaultRetryPolicy,
 	}
-	return &accrualWorker
+
+	for _, opt := range options {
+		opt(accrualWorker)
+	}
+
+	return accrualWorker
 }
 
-func (w *accrualWorker) Process(ctx context.Context) error {
-	orderID, err := w.storager.GetOrderForAccrual(ctx)
+// Process берет в аренду батч заказов и проверяет их по одному. Пока идет обработка, аренда продлевается,
+// а то, что не успели обработать, отпускается в конце
+func (w *accrualWorker) Process(ctx context.Context) (time.Duration, error) {
+	owner := w.newOwner()
+
+	jobs, err := w.storager.ClaimOrdersForAccrual(ctx, owner, w.batchSize, w.leaseTTL)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			logger.Log.Info("getAccrualWorker-noRowsForProcessing")
-			time.Sleep(200 * time.Millisecond)
-			return nil
+		logger.Log.Error("getAccrualWorker-storager-ClaimOrdersForAccrual-err", zap.Error(err))
+		return 0, err
+	}
+
+	if len(jobs) == 0 {
+		return w.idle(ctx), nil
+	}
+
+	stopKeepAlive := w.keepLeases(ctx, owner)
+	defer func() {
+		stopKeepAlive()
+		// при жесткой остановке ctx уже отменен, а аренду все равно стоит отпустить
+		if err := w.storager.ReleaseOrderLeases(context.WithoutCancel(ctx), owner); err != nil {
+			logger.Log.Error("getAccrualWorker-storager-ReleaseOrderLeases-err", zap.Error(err), zap.String("owner", owner))
+		}
+	}()
+
+	for _, job := range jobs {
+		// при остановке сервиса доделываем текущий заказ, остальные отпустит defer
+		if workers.Stopping(ctx) {
+			return 0, nil
+		}
+
+		retryAfter, err := w.processOrder(ctx, owner, job)
+		if err != nil {
+			var open *accrualclient.CircuitOpenError
+			if errors.As(err, &open) {
+				// accrual лежит: простаиваем до пробного запроса, остаток батча отпустит defer
+				return max(open.RetryAfter, minIdle), nil
+			}
+			return 0, err
+		}
+		if retryAfter > 0 {
+			// остаток батча отпустит defer
+			return w.backoff(ctx, retryAfter), nil
 		}
-		logger.Log.Error("getAccrualWorker-storager-GetOrderForAccrual-err", zap.Error(err))
-		return err
 	}
 
-	code, accrual, err := w.accrualService.GetAccrual(orderID)
+	return 0, nil
+}
+
+// processOrder возвращает ошибку, только если дело не в заказе: сеть, база, отмена. На 429 возвращает, сколько ждать.
+// На ответ accrual, который не разобрать, заказ уходит на повтор с backoff через failAttempt
+func (w *accrualWorker) processOrder(ctx context.Context, owner string, job model.AccrualJob) (retryAfter time.Duration, err error) {
+	orderID := job.OrderID
+
+	ctx, span := tracer.Start(ctx, "getaccrual.processOrder", trace.WithAttributes(attribute.String("order_id", orderID)))
+	defer span.End()
+
+	result, err := w.accrualService.GetAccrual(ctx, orderID)
 	if err != nil {
+		if errors.Is(err, accrualclient.ErrCircuitOpen) {
+			return 0, err
+		}
+		var unexpected *accrualclient.UnexpectedStatusError
+		if errors.Is(err, accrualclient.ErrMalformedResponse) || errors.Is(err, accrualclient.ErrUnknownStatus) || errors.As(err, &unexpected) {
+			return 0, w.failAttempt(ctx, owner, job, err)
+		}
 		logger.Log.Error("getAccrualWorker-accrualService-GetAccrual-err", zap.Error(err), zap.String("order_id", orderID))
-		return err
+		return 0, err
 	}
 
-	logger.Log.Info("getAccrualWorker-accrualService-GetAccrual", zap.String("order_id", orderID), zap.String("status code", strconv.Itoa(code)), zap.String("status", accrual.Status))
+	logger.Log.Info("getAccrualWorker-accrualService-GetAccrual", zap.String("order_id", orderID), zap.Stringer("result", result.Status))
 
-	switch code {
-	case http.StatusNoContent:
-		logger.Log.Warn("getAccrualWorker-accrualService-GetAccrual-StatusNoContent", zap.String("order_id", orderID))
-		return nil
-	case http.StatusTooManyRequests:
-		logger.Log.Warn("getAccrualWorker-accrualService-GetAccrual-StatusTooManyRequests", zap.String("order_id", orderID))
-		time.Sleep(2 * time.Second)
-		return nil
-	case http.StatusOK:
-	default:
-		err = fmt.Errorf("getAccrualWorker accrualService incorrect responce code: %d", code)
-		logger.Log.Error(err.Error(), zap.String("order_id", orderID))
-		return err
+	switch result.Status {
+	case accrualclient.ResultRateLimited:
+		logger.Log.Warn("getAccrualWorker-accrualService-GetAccrual-rate-limited", zap.String("order_id", orderID), zap.Duration("retry_after", result.RetryAfter))
+		return max(result.RetryAfter, minIdle), nil
+	case accrualclient.ResultNotFound:
+		logger.Log.Warn("getAccrualWorker-accrualService-GetAccrual-not-found", zap.String("order_id", orderID))
+		return 0, nil
 	}
 
-	err = w.storager.SetAccrual(ctx, accrual)
+	err = w.storager.SetAccrual(ctx, result.Accrual, owner)
 	if err != nil {
+		if errors.Is(err, model.ErrOrderLeaseLost) {
+			// заказ уже у другого воркера, он и сохранит результат
+			logger.Log.Warn("getAccrualWorker-storager-SetAccrual-lease-lost", zap.String("order_id", orderID), zap.String("owner", owner))
+			return 0, nil
+		}
+		if errors.Is(err, model.ErrIllegalOrderTransition) {
+			// accrual ответил статусом, в который заказ перейти не может: как и на мусорный ответ, повторяем и в итоге - dead letter
+			return 0, w.failAttempt(ctx, owner, job, err)
+		}
 		logger.Log.Error("getAccrualWorker-storager-SetAccrual-err", zap.Error(err))
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// failAttempt откладывает заказ по RetryPolicy или отправляет его в dead letter
+func (w *accrualWorker) failAttempt(ctx context.Context, owner string, job model.AccrualJob, cause error) error {
+	attempts := job.Attempts + 1
+	retryIn, deadLetter := w.retry.next(attempts)
+
+	err := w.storager.FailOrderAttempt(ctx, job.OrderID, owner, cause.Error(), retryIn, deadLetter)
+	if err != nil {
+		if errors.Is(err, model.ErrOrderLeaseLost) {
+			logger.Log.Warn("getAccrualWorker-storager-FailOrderAttempt-lease-lost", zap.String("order_id", job.OrderID), zap.String("owner", owner))
+			return nil
+		}
+		logger.Log.Error("getAccrualWorker-storager-FailOrderAttempt-err", zap.Error(err), zap.String("order_id", job.OrderID))
 		return err
 	}
 
+	if deadLetter {
+		metrics.OrdersDeadLettered.Inc()
+		logger.Log.Error("getAccrualWorker-order-dead-lettered", zap.Error(cause), zap.String("order_id", job.OrderID), zap.Int("attempts", attempts))
+		return nil
+	}
+
+	logger.Log.Warn("getAccrualWorker-order-attempt-failed", zap.Error(cause), zap.String("order_id", job.OrderID),
+		zap.Int("attempts", attempts), zap.Duration("retry_in", retryIn))
 	return nil
 }
+
+// backoff публикует паузу после 429 в базе, чтобы ее увидели воркеры других инстансов, и возвращает, сколько спать самому.
+// Воркеры этого инстанса узнают о паузе от общего клиента accrual
+func (w *accrualWorker) backoff(ctx context.Context, retryAfter time.Duration) time.Duration {
+	if err := w.storager.SetAccrualBackoff(ctx, retryAfter); err != nil {
+		logger.Log.Error("getAccrualWorker-storager-SetAccrualBackoff-err", zap.Error(err))
+	}
+
+	return max(retryAfter, minIdle)
+}
+
+// keepLeases продлевает аренду батча каждую треть leaseTTL, пока воркер его обрабатывает
+func (w *accrualWorker) keepLeases(ctx context.Context, owner string) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(w.leaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.storager.ExtendOrderLeases(ctx, owner, w.leaseTTL); err != nil {
+					logger.Log.Error("getAccrualWorker-storager-ExtendOrderLeases-err", zap.Error(err), zap.String("owner", owner))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// newOwner - уникальный владелец аренды на каждый батч: инстанс плюс номер захвата
+func (w *accrualWorker) newOwner() string {
+	return fmt.Sprintf("%s-%d", w.instanceID, w.claims.Add(1))
+}
+
+// idle - очередь пуста: спим до срока ближайшего заказа, но не дольше pollInterval.
+// Новые заказы будят воркер раньше через NOTIFY
+func (w *accrualWorker) idle(ctx context.Context) time.Duration {
+	delay, ok, err := w.storager.GetNextOrderDelay(ctx)
+	if err != nil {
+		logger.Log.Error("getAccrualWorker-storager-GetNextOrderDelay-err", zap.Error(err))
+		return w.pollInterval
+	}
+
+	if !ok {
+		return w.pollInterval
+	}
+
+	return min(max(delay, minIdle), w.pollInterval)
+}
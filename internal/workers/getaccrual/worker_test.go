@@ -0,0 +1,217 @@
+package getaccrual
+
+import (
+	"context"
+	accrualclient "gophermart/internal/accrual"
+	"gophermart/internal/accrualfake"
+	"gophermart/internal/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failedAttempt struct {
+	orderID    string
+	retryIn    time.Duration
+	deadLetter bool
+}
+
+// fakeStorage - очередь заказов в памяти вместо user_orders
+type fakeStorage struct {
+	mu       sync.Mutex
+	queue    []model.AccrualJob
+	accruals []model.Accrual
+	failed   []failedAttempt
+	backoff  []time.Duration
+	released int
+	setErr   error
+}
+
+func (s *fakeStorage) ClaimOrdersForAccrual(_ context.Context, _ string, limit int, _ time.Duration) ([]model.AccrualJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(limit, len(s.queue))
+	jobs := s.queue[:n]
+	s.queue = s.queue[n:]
+	return jobs, nil
+}
+
+func (s *fakeStorage) FailOrderAttempt(_ context.Context, orderID, _, _ string, retryIn time.Duration, deadLetter bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = append(s.failed, failedAttempt{orderID: orderID, retryIn: retryIn, deadLetter: deadLetter})
+	return nil
+}
+
+func (s *fakeStorage) ExtendOrderLeases(context.Context, string, time.Duration) error {
+	return nil
+}
+
+func (s *fakeStorage) ReleaseOrderLeases(context.Context, string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.released++
+	return nil
+}
+
+func (s *fakeStorage) SetAccrualBackoff(_ context.Context, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.backoff = append(s.backoff, d)
+	return nil
+}
+
+func (s *fakeStorage) GetNextOrderDelay(context.Context) (time.Duration, bool, error) {
+	return 0, false, nil
+}
+
+func (s *fakeStorage) SetAccrual(_ context.Context, accrual model.Accrual, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.setErr != nil {
+		return s.setErr
+	}
+	s.accruals = append(s.accruals, accrual)
+	return nil
+}
+
+func jobs(orderIDs ...string) []model.AccrualJob {
+	jobs := make([]model.AccrualJob, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		jobs = append(jobs, model.AccrualJob{OrderID: orderID})
+	}
+	return jobs
+}
+
+func TestProcessStatuses(t *testing.T) {
+	fake := accrualfake.New(accrualfake.Script{})
+	fake.Script("1", accrualfake.Registered(), accrualfake.Processing(), accrualfake.Processed(500.5))
+	fake.Script("2", accrualfake.Invalid())
+	fake.Script("3", accrualfake.NotRegistered())
+
+	storage := &fakeStorage{}
+	w := New(storage, accrualclient.NewClient(fake.Start(t), time.Second))
+
+	for _, want := range []string{model.OrderStatusRegistered, model.OrderStatusProcessing, model.OrderStatusProcessed} {
+		storage.queue = jobs("1")
+		sleep, err := w.Process(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, sleep)
+		assert.Equal(t, want, storage.accruals[len(storage.accruals)-1].Status)
+	}
+	assert.Equal(t, model.Money(50050), storage.accruals[2].Accrual)
+
+	storage.queue = jobs("2", "3")
+	_, err := w.Process(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, storage.accruals, 4, "204 is not saved")
+	assert.Equal(t, model.Accrual{Order: "2", Status: model.OrderStatusInvalid}, storage.accruals[3])
+	assert.Empty(t, storage.failed)
+	assert.Equal(t, 1, fake.Calls("3"))
+}
+
+func TestProcessEmptyQueue(t *testing.T) {
+	fake := accrualfake.New(accrualfake.DefaultScript)
+	w := New(&fakeStorage{}, accrualclient.NewClient(fake.Start(t), time.Second), WithPollInterval(time.Minute))
+
+	sleep, err := w.Process(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, sleep)
+}
+
+func TestProcessRateLimited(t *testing.T) {
+	fake := accrualfake.New(accrualfake.DefaultScript)
+	fake.Script("1", accrualfake.TooManyRequests(time.Minute, 60))
+
+	storage := &fakeStorage{queue: jobs("1", "2")}
+	w := New(storage, accrualclient.NewClient(fake.Start(t), time.Second))
+
+	sleep, err := w.Process(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, sleep)
+	assert.Equal(t, []time.Duration{time.Minute}, storage.backoff, "pause is published for other instances")
+	assert.Zero(t, fake.Calls("2"), "rest of the batch waits")
+	assert.Equal(t, 1, storage.released)
+	assert.Empty(t, storage.failed)
+}
+
+func TestProcessRetriesBadResponses(t *testing.T) {
+	fake := accrualfake.New(accrualfake.DefaultScript)
+	fake.Script("1", accrualfake.Malformed())
+	fake.Script("2", accrualfake.Step{Status: "DONE"})
+	fake.Script("3", accrualfake.ServerError())
+
+	storage := &fakeStorage{queue: []model.AccrualJob{
+		{OrderID: "1"},
+		{OrderID: "2", Attempts: 1},
+		{OrderID: "3", Attempts: 2},
+	}}
+	w := New(storage, accrualclient.NewClient(fake.Start(t), time.Second),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}))
+
+	_, err := w.Process(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, storage.failed, 3)
+	assert.Empty(t, storage.accruals)
+
+	assert.Equal(t, "1", storage.failed[0].orderID)
+	assert.InDelta(t, 0.75, storage.failed[0].retryIn.Seconds(), 0.25)
+	assert.False(t, storage.failed[0].deadLetter)
+
+	assert.Equal(t, "2", storage.failed[1].orderID)
+	assert.InDelta(t, 1.5, storage.failed[1].retryIn.Seconds(), 0.5)
+	assert.False(t, storage.failed[1].deadLetter)
+
+	assert.Equal(t, failedAttempt{orderID: "3", deadLetter: true}, storage.failed[2])
+}
+
+func TestProcessBreakerOpen(t *testing.T) {
+	fake := accrualfake.New(accrualfake.Script{Default: []accrualfake.Step{accrualfake.ServerError()}})
+
+	storage := &fakeStorage{queue: jobs("1", "2", "3")}
+	client := accrualclient.NewClient(fake.Start(t), time.Second,
+		accrualclient.WithBreaker(accrualclient.BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}))
+	w := New(storage, client)
+
+	sleep, err := w.Process(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute.Seconds(), sleep.Seconds(), 1, "worker idles until the probe")
+	assert.Len(t, storage.failed, 2)
+	assert.Zero(t, fake.Calls("3"), "open breaker does not call accrual")
+	assert.Empty(t, storage.backoff, "breaker pause is local to the instance")
+}
+
+func TestProcessTimeout(t *testing.T) {
+	fake := accrualfake.New(accrualfake.Script{Default: []accrualfake.Step{accrualfake.Processed(1).After(time.Second)}})
+
+	storage := &fakeStorage{queue: jobs("1")}
+	w := New(storage, accrualclient.NewClient(fake.Start(t), 50*time.Millisecond))
+
+	_, err := w.Process(context.Background())
+	assert.ErrorIs(t, err, accrualclient.ErrUnavailable)
+	assert.Empty(t, storage.accruals)
+	assert.Empty(t, storage.failed, "unreachable accrual is not the order's fault")
+	assert.Equal(t, 1, storage.released)
+}
+
+func TestProcessIllegalTransition(t *testing.T) {
+	fake := accrualfake.New(accrualfake.Script{Default: []accrualfake.Step{accrualfake.Processing()}})
+
+	storage := &fakeStorage{queue: jobs("1"), setErr: model.ErrIllegalOrderTransition}
+	w := New(storage, accrualclient.NewClient(fake.Start(t), time.Second))
+
+	_, err := w.Process(context.Background())
+	require.NoError(t, err)
+	require.Len(t, storage.failed, 1, "odd accrual answer is retried like a bad response")
+	assert.False(t, storage.failed[0].deadLetter)
+}
@@ -0,0 +1,244 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"gophermart/internal/logger"
+	"gophermart/internal/metrics"
+	"gophermart/internal/model"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PoolConfig - границы и правила автомасштабирования пула
+type PoolConfig struct {
+	Min int
+	Max int
+	// ScaleInterval - как часто пул пересматривает число воркеров
+	ScaleInterval time.Duration
+	// BacklogPerWorker - сколько ждущих заказов приходится на одного воркера
+	BacklogPerWorker int
+	// MaxLatency - если accrual отвечает дольше, пул не растет, а сжимается: больше запросов сделают только хуже. 0 - не учитывать
+	MaxLatency time.Duration
+}
+
+var DefaultPoolConfig = PoolConfig{
+	Min:              3,
+	Max:              10,
+	ScaleInterval:    15 * time.Second,
+	BacklogPerWorker: 50,
+	MaxLatency:       2 * time.Second,
+}
+
+// desired - сколько воркеров нужно при такой очереди и задержке accrual
+func (c PoolConfig) desired(current int, backlog int64, latency time.Duration) int {
+	want := int((backlog + int64(c.BacklogPerWorker) - 1) / int64(c.BacklogPerWorker))
+
+	if c.MaxLatency > 0 && latency > c.MaxLatency {
+		want = min(want, current-1)
+	}
+
+	return min(max(want, c.Min), c.Max)
+}
+
+// PoolOption описывает функциональную опцию для конфигурации пула.
+type PoolOption func(*Pool)
+
+// WithBacklog задает источник длины очереди. Без него пул не масштабируется и держит Min воркеров
+func WithBacklog(backlog func(ctx context.Context) (int64, error)) PoolOption {
+	return func(p *Pool) {
+		p.backlog = backlog
+	}
+}
+
+// WithLatency задает источник задержки ответа accrual
+func WithLatency(latency func() time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.latency = latency
+	}
+}
+
+// Pool держит от Min до Max одинаковых воркеров в группе, подстраивает их число под очередь
+// и дает ставить пул на паузу и менять границы на ходу
+type Pool struct {
+	group   *Group
+	worker  Worker
+	wake    *Signal
+	backlog func(ctx context.Context) (int64, error)
+	latency func() time.Duration
+
+	mu          sync.Mutex
+	cfg         PoolConfig
+	ctx         context.Context
+	cancels     []context.CancelFunc
+	target      int
+	paused      bool
+	lastBacklog int64
+	started     int
+}
+
+func NewPool(group *Group, worker Worker, wake *Signal, cfg PoolConfig, options ...PoolOption) (*Pool, error) {
+	if err := validatePoolSize(cfg.Min, cfg.Max); err != nil {
+		return nil, fmt.Errorf("NewPool-err: %w", err)
+	}
+	if cfg.ScaleInterval <= 0 {
+		cfg.ScaleInterval = DefaultPoolConfig.ScaleInterval
+	}
+	if cfg.BacklogPerWorker <= 0 {
+		cfg.BacklogPerWorker = DefaultPoolConfig.BacklogPerWorker
+	}
+
+	p := &Pool{
+		group:   group,
+		worker:  worker,
+		wake:    wake,
+		cfg:     cfg,
+		target:  cfg.Min,
+		latency: func() time.Duration { return 0 },
+	}
+
+	for _, opt := range options {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+func validatePoolSize(minWorkers, maxWorkers int) error {
+	if minWorkers < 0 || maxWorkers < 1 || minWorkers > maxWorkers {
+		return fmt.Errorf("%w: min %d, max %d", model.ErrInvalidPoolSize, minWorkers, maxWorkers)
+	}
+	return nil
+}
+
+// Run запускает Min воркеров и раз в ScaleInterval пересматривает их число. Блокирует до отмены ctx,
+// запускать через Group.Go, чтобы Wait дождался и пул, и воркеров
+func (p *Pool) Run(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.apply()
+	p.mu.Unlock()
+
+	ticker := time.NewTicker(p.cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.autoscale(ctx)
+		}
+	}
+}
+
+func (p *Pool) autoscale(ctx context.Context) {
+	if p.backlog == nil {
+		return
+	}
+
+	backlog, err := p.backlog(ctx)
+	if err != nil {
+		logger.Log.Error("Pool-backlog-err", zap.Error(err))
+		return
+	}
+	latency := p.latency()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastBacklog = backlog
+	target := p.cfg.desired(p.target, backlog, latency)
+	if target != p.target {
+		logger.Log.Info("Pool-autoscale", zap.Int("from", p.target), zap.Int("to", target),
+			zap.Int64("backlog", backlog), zap.Duration("accrual_latency", latency))
+		p.target = target
+	}
+	p.apply()
+}
+
+// Pause останавливает всех воркеров: каждый доделывает текущую задачу и выходит
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		logger.Log.Info("Pool-paused")
+	}
+	p.paused = true
+	p.apply()
+}
+
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		logger.Log.Info("Pool-resumed")
+	}
+	p.paused = false
+	p.apply()
+}
+
+// Resize меняет границы пула. Min = Max фиксирует число воркеров
+func (p *Pool) Resize(minWorkers, maxWorkers int) error {
+	if err := validatePoolSize(minWorkers, maxWorkers); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	logger.Log.Info("Pool-resized", zap.Int("min", minWorkers), zap.Int("max", maxWorkers))
+	p.cfg.Min = minWorkers
+	p.cfg.Max = maxWorkers
+	p.target = min(max(p.target, minWorkers), maxWorkers)
+	p.apply()
+
+	return nil
+}
+
+func (p *Pool) Status() model.WorkerPoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return model.WorkerPoolStatus{
+		Running:        len(p.cancels),
+		Target:         p.target,
+		Min:            p.cfg.Min,
+		Max:            p.cfg.Max,
+		Paused:         p.paused,
+		Backlog:        p.lastBacklog,
+		AccrualLatency: p.latency().String(),
+	}
+}
+
+// apply запускает или останавливает воркеров до target, на паузе - до нуля. Вызывается под mu.
+// До Run и после отмены его контекста ничего не делает: новые воркеры при остановке сервиса не нужны
+func (p *Pool) apply() {
+	if p.ctx == nil || p.ctx.Err() != nil {
+		return
+	}
+
+	want := p.target
+	if p.paused {
+		want = 0
+	}
+
+	for len(p.cancels) < want {
+		ctx, cancel := context.WithCancel(p.ctx)
+		p.group.Start(ctx, p.worker, p.wake, p.started)
+		p.started++
+		p.cancels = append(p.cancels, cancel)
+	}
+
+	for len(p.cancels) > want {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+
+	metrics.AccrualWorkers.Set(float64(len(p.cancels)))
+}
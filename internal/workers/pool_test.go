@@ -0,0 +1,93 @@
+package workers
+
+import (
+	"context"
+	"gophermart/internal/model"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolDesired(t *testing.T) {
+	cfg := PoolConfig{Min: 2, Max: 6, BacklogPerWorker: 10, MaxLatency: time.Second}
+
+	tests := []struct {
+		name    string
+		current int
+		backlog int64
+		latency time.Duration
+		want    int
+	}{
+		{name: "empty queue keeps min", current: 4, backlog: 0, want: 2},
+		{name: "scales with backlog", current: 2, backlog: 41, want: 5},
+		{name: "capped by max", current: 2, backlog: 1000, want: 6},
+		{name: "slow accrual shrinks pool", current: 5, backlog: 1000, latency: 2 * time.Second, want: 4},
+		{name: "slow accrual never below min", current: 2, backlog: 1000, latency: 2 * time.Second, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cfg.desired(tt.current, tt.backlog, tt.latency))
+		})
+	}
+}
+
+// countingWorker считает запущенные горутины воркера: Process живет, пока воркер не остановят
+type countingWorker struct {
+	running atomic.Int32
+}
+
+func (w *countingWorker) Process(ctx context.Context) (time.Duration, error) {
+	w.running.Add(1)
+	defer w.running.Add(-1)
+
+	for !Stopping(ctx) {
+		time.Sleep(time.Millisecond)
+	}
+	return 0, nil
+}
+
+func TestPool(t *testing.T) {
+	w := &countingWorker{}
+	g := NewGroup()
+
+	var backlog atomic.Int64
+	p, err := NewPool(g, w, nil, PoolConfig{Min: 1, Max: 4, ScaleInterval: 10 * time.Millisecond, BacklogPerWorker: 10},
+		WithBacklog(func(context.Context) (int64, error) { return backlog.Load(), nil }),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Go(func() { p.Run(ctx) })
+
+	running := func(n int32) {
+		t.Helper()
+		assert.Eventually(t, func() bool { return w.running.Load() == n }, time.Second, 5*time.Millisecond)
+	}
+
+	running(1)
+
+	backlog.Store(35)
+	running(4)
+	assert.Equal(t, model.WorkerPoolStatus{Running: 4, Target: 4, Min: 1, Max: 4, Backlog: 35, AccrualLatency: "0s"}, p.Status())
+
+	p.Pause()
+	running(0)
+	assert.True(t, p.Status().Paused)
+
+	p.Resume()
+	running(4)
+
+	require.NoError(t, p.Resize(2, 2))
+	running(2)
+	assert.ErrorIs(t, p.Resize(3, 1), model.ErrInvalidPoolSize)
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, g.Wait(waitCtx))
+	assert.Zero(t, w.running.Load())
+}
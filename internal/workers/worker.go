@@ -4,29 +4,151 @@ import (
 	"context"
 	"gophermart/internal/logger"
 	"strconv"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// errorBackoff - пауза после ошибки Process, чтобы упавшая база или accrual не раскручивали цикл вхолостую
+const errorBackoff = time.Second
+
 type Worker interface {
-	Process(ctx context.Context) error
+	// Process выполняет одну задачу и возвращает, сколько можно спать до следующего вызова:
+	// 0 - сразу за следующей задачей. Сон прерывается сигналом Wake и отменой контекста
+	Process(ctx context.Context) (time.Duration, error)
+}
+
+// Group следит за горутинами воркеров, чтобы при остановке дождаться, пока они доделают текущий заказ
+type Group struct {
+	wg sync.WaitGroup
+
+	// abort отменяет контекст начатых Process, см. Abort
+	abort       context.Context
+	abortCancel context.CancelFunc
+}
+
+func NewGroup() *Group {
+	abort, abortCancel := context.WithCancel(context.Background())
+	return &Group{abort: abort, abortCancel: abortCancel}
 }
 
-func Start(ctx context.Context, w Worker, schedule time.Duration, workerNumber int) {
-	go run(ctx, w, schedule, workerNumber)
+// Start запускает воркер, который крутится до отмены ctx. Отмена не прерывает уже начатый Process:
+// он получает контекст, который отменяет только Abort.
+// wake будит воркер раньше срока, может быть nil
+func (g *Group) Start(ctx context.Context, w Worker, wake *Signal, workerNumber int) {
+	g.Go(func() {
+		processCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		stop := context.AfterFunc(g.abort, cancel)
+		defer stop()
+
+		run(ctx, processCtx, w, wake, workerNumber)
+	})
+}
+
+// Go запускает в группе вспомогательную горутину, например слушателя уведомлений. fn должна вернуться после отмены своего контекста
+func (g *Group) Go(fn func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn()
+	}()
+}
+
+// Wait ждет завершения всех воркеров группы, но не дольше ctx
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Abort отменяет контекст уже начатых Process: запросы в accrual и базу обрываются.
+// Нужен, когда воркеры не уложились в срок остановки, чтобы не держать пул и accrual после нее
+func (g *Group) Abort() {
+	g.abortCancel()
+}
+
+type stoppingKey struct{}
+
+// Stopping сообщает Process, что группа останавливается: текущую задачу надо доделать, а новые - не начинать.
+// Сам ctx в Process при остановке не отменяется
+func Stopping(ctx context.Context) bool {
+	done, ok := ctx.Value(stoppingKey{}).(<-chan struct{})
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
 }
 
-func run(ctx context.Context, w Worker, period time.Duration, workerNumber int) {
+func run(ctx, processCtx context.Context, w Worker, wake *Signal, workerNumber int) {
+	processCtx = context.WithValue(processCtx, stoppingKey{}, ctx.Done())
 	for {
-		time.Sleep(period)
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err := w.Process(ctx); err != nil {
-				logger.Log.Error("Worker-error", zap.Error(err), zap.String("worker number", strconv.Itoa(workerNumber)))
+		// канал берется до Process: сигнал, пришедший во время обработки, разбудит сразу
+		woken := wake.C()
+
+		sleep, err := w.Process(processCtx)
+		if err != nil {
+			logger.Log.Error("Worker-error", zap.Error(err), zap.String("worker number", strconv.Itoa(workerNumber)))
+			sleep = max(sleep, errorBackoff)
+		}
+
+		if sleep > 0 {
+			timer := time.NewTimer(sleep)
+			select {
+			case <-ctx.Done():
+			case <-woken:
+			case <-timer.C:
 			}
+			timer.Stop()
+		}
+
+		// select выбирает случайно, если готовы несколько: после отмены новый заказ не берем
+		if ctx.Err() != nil {
+			return
 		}
 	}
 }
+
+// Signal будит всех ждущих воркеров разом. Каждый Broadcast закрывает текущий канал и заводит новый
+type Signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func NewSignal() *Signal {
+	return &Signal{ch: make(chan struct{})}
+}
+
+// C возвращает канал, который закроется при следующем Broadcast. У nil-сигнала канал nil - он никогда не срабатывает
+func (s *Signal) C() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ch
+}
+
+func (s *Signal) Broadcast() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+}
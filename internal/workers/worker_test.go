@@ -0,0 +1,129 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWorker сигналит о старте Process и ждет release, как заказ, застрявший в SetAccrual
+type blockingWorker struct {
+	started  chan struct{}
+	release  chan struct{}
+	finished atomic.Int32
+	canceled atomic.Bool
+}
+
+func (w *blockingWorker) Process(ctx context.Context) (time.Duration, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	if ctx.Err() != nil {
+		w.canceled.Store(true)
+	}
+	w.finished.Add(1)
+	return 0, nil
+}
+
+func TestGroupFinishesCurrentJob(t *testing.T) {
+	w := &blockingWorker{started: make(chan struct{}, 1), release: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroup()
+	g.Start(ctx, w, nil, 0)
+
+	<-w.started
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	assert.ErrorIs(t, g.Wait(waitCtx), context.DeadlineExceeded, "worker is still busy with the current job")
+
+	close(w.release)
+
+	waitCtx, waitCancel = context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, g.Wait(waitCtx))
+
+	assert.Equal(t, int32(1), w.finished.Load(), "no new jobs after cancel")
+	assert.False(t, w.canceled.Load(), "current job must not see the shutdown")
+}
+
+func TestGroupAbort(t *testing.T) {
+	w := &contextWorker{started: make(chan struct{}, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroup()
+	g.Start(ctx, w, nil, 0)
+
+	<-w.started
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	require.ErrorIs(t, g.Wait(waitCtx), context.DeadlineExceeded)
+
+	g.Abort()
+
+	waitCtx, waitCancel = context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, g.Wait(waitCtx), "aborted job returns")
+}
+
+// contextWorker висит, пока не отменят его контекст, как запрос в accrual
+type contextWorker struct {
+	started chan struct{}
+}
+
+func (w *contextWorker) Process(ctx context.Context) (time.Duration, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+// idleWorker считает вызовы и всегда просит поспать подольше
+type idleWorker struct {
+	calls chan struct{}
+}
+
+func (w *idleWorker) Process(context.Context) (time.Duration, error) {
+	w.calls <- struct{}{}
+	return time.Hour, nil
+}
+
+func TestSignalWakesIdleWorker(t *testing.T) {
+	w := &idleWorker{calls: make(chan struct{}, 10)}
+	wake := NewSignal()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroup()
+	g.Start(ctx, w, wake, 0)
+
+	<-w.calls
+	select {
+	case <-w.calls:
+		t.Fatal("idle worker must sleep until woken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	wake.Broadcast()
+	select {
+	case <-w.calls:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not woken by the signal")
+	}
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, g.Wait(waitCtx), "cancel must interrupt the sleep")
+}